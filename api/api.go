@@ -1,9 +1,14 @@
 package api
 
 // module deps
+import "fmt"
+import "os"
 import "mime"
+import "time"
+import "strconv"
 import "net/url"
 import "net/http"
+import "encoding/json"
 import "github.com/labstack/echo"
 import "github.com/r8k/crawl/crawler"
 
@@ -12,11 +17,63 @@ type Handler struct {
 	Crawler *crawler.Crawler
 }
 
+// content types of the export formats
+var exportContentTypes = map[string]string{
+	crawler.ExportGraphML: "application/graphml+xml",
+	crawler.ExportDOT:     "text/vnd.graphviz",
+	crawler.ExportCSV:     "text/csv",
+	crawler.ExportJSONL:   "application/x-ndjson",
+}
+
 // Domain struct for using in request & response
 type Domain struct {
-	Domain string               `json:"domain"`
-	Depth  int                  `json:"depth,omitempty"`
-	Status crawler.WorkerStatus `json:"status,omitempty"`
+	Domain         string               `json:"domain"`
+	Depth          int                  `json:"depth,omitempty"`
+	CrawlDelay     float64              `json:"crawl_delay,omitempty"`
+	UseSitemaps    bool                 `json:"use_sitemaps,omitempty"`
+	Archive        bool                 `json:"archive,omitempty"`
+	RequestTimeout float64              `json:"request_timeout,omitempty"`
+	ConnectTimeout float64              `json:"connect_timeout,omitempty"`
+	ReadTimeout    float64              `json:"read_timeout,omitempty"`
+	Politeness     string               `json:"politeness,omitempty"`
+	Include        []string             `json:"include,omitempty"`
+	Exclude        []string             `json:"exclude,omitempty"`
+	Scope          string               `json:"scope,omitempty"`
+	Hosts          []string             `json:"hosts,omitempty"`
+	SkipDuplicates bool                 `json:"skip_duplicates,omitempty"`
+	Audit          bool                 `json:"audit,omitempty"`
+	Status         crawler.WorkerStatus `json:"status,omitempty"`
+	Run            int                  `json:"run,omitempty"`
+	Pending        int                  `json:"pending,omitempty"`
+	Resumed        bool                 `json:"resumed,omitempty"`
+	Rate           float64              `json:"rate,omitempty"`
+	Concurrency    int                  `json:"concurrency,omitempty"`
+}
+
+// seconds converts a duration in seconds to a time.Duration
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// Options converts the request payload to crawler options
+func (d *Domain) Options() crawler.Options {
+	return crawler.Options{
+		Depth:       d.Depth,
+		CrawlDelay:  seconds(d.CrawlDelay),
+		UseSitemaps: d.UseSitemaps,
+		Archive:     d.Archive,
+
+		RequestTimeout: seconds(d.RequestTimeout),
+		ConnectTimeout: seconds(d.ConnectTimeout),
+		ReadTimeout:    seconds(d.ReadTimeout),
+		Politeness:     d.Politeness,
+		Include:        d.Include,
+		Exclude:        d.Exclude,
+		Scope:          d.Scope,
+		Hosts:          d.Hosts,
+		SkipDuplicates: d.SkipDuplicates,
+		Audit:          d.Audit,
+	}
 }
 
 // HasContentType determines if http.Request has the content-type
@@ -35,8 +92,25 @@ func HasContentType(r *http.Request, mimetype string) (bool, error) {
 // below is a sample payload with their data types included
 // { "domain": "http://cloudflare.com", "depth": 3 }
 //
-// domain - required, string
-// depth  - int,      optional; defaults to 5
+// domain          - required, string
+// depth           - int,      optional; defaults to 5
+// crawl_delay     - float,    optional; seconds, overrides robots.txt Crawl-delay
+// use_sitemaps    - bool,     optional; seeds the crawl from the sitemaps
+// archive         - bool,     optional; writes the responses to a WARC file
+// request_timeout - float,    optional; seconds, per request; defaults to 60
+// connect_timeout - float,    optional; seconds, to connect; defaults to 10
+// read_timeout    - float,    optional; seconds, between two reads; defaults to 30
+// politeness      - string,   optional; static, the default, or adaptive
+// include         - []string, optional; patterns of the URLs to crawl
+// exclude         - []string, optional; patterns of the URLs to skip
+// scope           - string,   optional; host, the default, domain, hosts or prefix
+// hosts           - []string, optional; hosts crawled besides the seed's, in hosts scope
+// skip_duplicates - bool,     optional; does not follow the links of near-duplicate pages
+// audit           - bool,     optional; ignores nofollow & noindex, which are still flagged
+//
+// a pattern is matched against the path & query of a URL, such as
+// /search?q=go; it is a glob, where * does not match / and ** does,
+// or a regular expression when prefixed by re:, e.g. re:^/20\d\d/
 func (h *Handler) CreateDomainHandler(ctx echo.Context) error {
 	var err error
 	var isJSON bool
@@ -52,7 +126,7 @@ func (h *Handler) CreateDomainHandler(ctx echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	err = h.Crawler.Crawl(domain.Domain, domain.Depth)
+	err = h.Crawler.CrawlWithOptions(domain.Domain, domain.Options())
 	if err != nil {
 		ctx.Logger().Errorf("cannot initialise crawler; error: %v\n", err.Error())
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
@@ -113,6 +187,52 @@ func (h *Handler) GetDomainStatusHandler(ctx echo.Context) error {
 		return ctx.NoContent(http.StatusNotFound)
 	}
 
+	politeness := worker.Politeness()
+	status := &Domain{
+		Domain:      domain,
+		Status:      worker.Status(),
+		Depth:       worker.CrawlDepth(),
+		CrawlDelay:  politeness.Delay.Seconds(),
+		Politeness:  politeness.Mode,
+		Rate:        politeness.Rate(),
+		Concurrency: politeness.Concurrency,
+		Run:         worker.Run(),
+		Pending:     worker.Pending(),
+		Resumed:     worker.Resumed(),
+	}
+
+	return ctx.JSON(http.StatusOK, status)
+}
+
+// DeleteDomainHandler is the api.Handler to cancel a domain's crawl
+// and remove it from the registry, so that it can be crawled again
+// the domain is expected in the URL path parameter, such as
+// /domains/https%3A%2F%2Fcloudflare.com
+//
+// the requests in flight are cancelled, and the handler responds
+// once the crawler's goroutines for the domain have drained
+func (h *Handler) DeleteDomainHandler(ctx echo.Context) error {
+	domain, err := url.PathUnescape(ctx.Param("domain"))
+	if err != nil {
+		ctx.Logger().Errorf("failed to unescape domain, %v\n", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	worker := h.Crawler.Worker(domain)
+	if worker == nil {
+		return ctx.NoContent(http.StatusNotFound)
+	}
+
+	err = h.Crawler.Cancel(domain)
+	switch err {
+	case nil:
+	case crawler.ErrDomainNotRegistered:
+		return ctx.NoContent(http.StatusNotFound)
+	default:
+		ctx.Logger().Errorf("failed to remove domain; error: %v\n", err.Error())
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
 	status := &Domain{
 		Domain: domain,
 		Status: worker.Status(),
@@ -121,3 +241,428 @@ func (h *Handler) GetDomainStatusHandler(ctx echo.Context) error {
 
 	return ctx.JSON(http.StatusOK, status)
 }
+
+// RecrawlDomainHandler is the api.Handler to start a fresh crawl of a
+// registered domain with the same settings; the previous tree is kept
+// as a numbered snapshot. the domain is expected in the URL path, such
+// as /domains/https%3A%2F%2Fcloudflare.com/recrawl
+func (h *Handler) RecrawlDomainHandler(ctx echo.Context) error {
+	domain, err := url.PathUnescape(ctx.Param("domain"))
+	if err != nil {
+		ctx.Logger().Errorf("failed to unescape domain, %v\n", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	err = h.Crawler.Recrawl(domain)
+	switch err {
+	case nil:
+	case crawler.ErrDomainNotRegistered:
+		return ctx.NoContent(http.StatusNotFound)
+	case crawler.ErrDomainAlreadyRegistered:
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	default:
+		ctx.Logger().Errorf("cannot initialise crawler; error: %v\n", err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	worker := h.Crawler.Worker(domain)
+	if worker == nil {
+		return ctx.NoContent(http.StatusNotFound)
+	}
+
+	status := &Domain{
+		Domain: domain,
+		Status: crawler.StatusInitialised,
+		Depth:  worker.CrawlDepth(),
+		Run:    worker.Run(),
+	}
+
+	return ctx.JSON(http.StatusAccepted, status)
+}
+
+// GetDomainSnapshotsHandler is the api.Handler to list the crawl runs
+// of a domain, without their trees; the domain is expected in the URL
+// path, such as /domains/https%3A%2F%2Fcloudflare.com/snapshots
+func (h *Handler) GetDomainSnapshotsHandler(ctx echo.Context) error {
+	domain, err := url.PathUnescape(ctx.Param("domain"))
+	if err != nil {
+		ctx.Logger().Errorf("failed to unescape domain, %v\n", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	worker := h.Crawler.Worker(domain)
+	if worker == nil {
+		return ctx.NoContent(http.StatusNotFound)
+	}
+
+	snapshots := make([]*crawler.Snapshot, 0)
+	for id := 1; id <= worker.Run(); id++ {
+		if snapshot := worker.Snapshot(id); snapshot != nil {
+			snapshots = append(snapshots, &crawler.Snapshot{
+				ID:      snapshot.ID,
+				Started: snapshot.Started,
+				Status:  snapshot.Status,
+			})
+		}
+	}
+
+	return ctx.JSON(http.StatusOK, snapshots)
+}
+
+// GetDomainSnapshotHandler is the api.Handler to query the tree of a
+// crawl run of a domain, the domain & run number are expected in the
+// URL path, such as /domains/https%3A%2F%2Fcloudflare.com/snapshots/1
+// like GetDomainHandler, the current run is not returned until it is
+// complete, since its tree is still being added to
+func (h *Handler) GetDomainSnapshotHandler(ctx echo.Context) error {
+	domain, err := url.PathUnescape(ctx.Param("domain"))
+	if err != nil {
+		ctx.Logger().Errorf("failed to unescape domain, %v\n", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	worker := h.Crawler.Worker(domain)
+	if worker == nil {
+		return ctx.NoContent(http.StatusNotFound)
+	}
+
+	snapshot := worker.Snapshot(id)
+	if snapshot == nil {
+		return ctx.NoContent(http.StatusNotFound)
+	}
+
+	if id == worker.Run() && worker.Status() != crawler.StatusFetchingComplete {
+		return ctx.NoContent(http.StatusNoContent)
+	}
+
+	return ctx.JSON(http.StatusOK, snapshot)
+}
+
+// GetDomainDiffHandler is the api.Handler to compare two crawl runs
+// of a domain, the domain is expected in the URL path parameter and
+// the run numbers in the query, such as
+// /domains/https%3A%2F%2Fcloudflare.com/diff?from=1&to=2
+//
+// to   - int, optional; defaults to the current run, once complete
+// from - int, optional; defaults to the run before to
+func (h *Handler) GetDomainDiffHandler(ctx echo.Context) error {
+	domain, err := url.PathUnescape(ctx.Param("domain"))
+	if err != nil {
+		ctx.Logger().Errorf("failed to unescape domain, %v\n", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	worker := h.Crawler.Worker(domain)
+	if worker == nil {
+		return ctx.NoContent(http.StatusNotFound)
+	}
+
+	to := worker.Run()
+	if param := ctx.QueryParam("to"); param != "" {
+		if to, err = strconv.Atoi(param); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	from := to - 1
+	if param := ctx.QueryParam("from"); param != "" {
+		if from, err = strconv.Atoi(param); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	a, b := worker.Snapshot(from), worker.Snapshot(to)
+	if a == nil || b == nil {
+		return ctx.NoContent(http.StatusNotFound)
+	}
+
+	// the tree of the current run is still being added to
+	current := worker.Run()
+	if (from == current || to == current) && worker.Status() != crawler.StatusFetchingComplete {
+		return ctx.NoContent(http.StatusNoContent)
+	}
+
+	return ctx.JSON(http.StatusOK, crawler.Diff(a.Tree, b.Tree))
+}
+
+// GetDomainBrokenLinksHandler is the api.Handler to report the links
+// of a domain's current run that responded 4xx / 5xx or could not be
+// fetched, along with every page linking to them; the domain is
+// expected in the URL path parameter, such as
+// /domains/https%3A%2F%2Fcloudflare.com/report/broken-links
+func (h *Handler) GetDomainBrokenLinksHandler(ctx echo.Context) error {
+	domain, err := url.PathUnescape(ctx.Param("domain"))
+	if err != nil {
+		ctx.Logger().Errorf("failed to unescape domain, %v\n", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	worker := h.Crawler.Worker(domain)
+	if worker == nil {
+		return ctx.NoContent(http.StatusNotFound)
+	}
+
+	return ctx.JSON(http.StatusOK, worker.BrokenLinks())
+}
+
+// GetDomainDuplicatesHandler is the api.Handler to report the groups
+// of pages of a domain's current run whose visible text is identical
+// or nearly so; the domain is expected in the URL path parameter, and
+// the max Hamming distance between their SimHashes in the query, e.g.
+// /domains/https%3A%2F%2Fcloudflare.com/report/duplicates?distance=3
+//
+// distance - int, optional; 0 to 63, defaults to 3
+func (h *Handler) GetDomainDuplicatesHandler(ctx echo.Context) error {
+	domain, err := url.PathUnescape(ctx.Param("domain"))
+	if err != nil {
+		ctx.Logger().Errorf("failed to unescape domain, %v\n", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	distance := crawler.DefaultSimHashDistance
+	if param := ctx.QueryParam("distance"); param != "" {
+		if distance, err = strconv.Atoi(param); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		if distance < 0 || distance > 63 {
+			return echo.NewHTTPError(http.StatusBadRequest, "distance is out of range")
+		}
+	}
+
+	worker := h.Crawler.Worker(domain)
+	if worker == nil {
+		return ctx.NoContent(http.StatusNotFound)
+	}
+
+	return ctx.JSON(http.StatusOK, worker.Duplicates(distance))
+}
+
+// GetDomainRedirectsHandler is the api.Handler to report the redirect
+// loops of a domain's current run, and its redirect chains of more than
+// max hops; the domain is expected in the URL path parameter, and the
+// max in the query, e.g.
+// /domains/https%3A%2F%2Fcloudflare.com/report/redirects?max=1
+//
+// max - int, optional; 0 or more, defaults to 1
+func (h *Handler) GetDomainRedirectsHandler(ctx echo.Context) error {
+	domain, err := url.PathUnescape(ctx.Param("domain"))
+	if err != nil {
+		ctx.Logger().Errorf("failed to unescape domain, %v\n", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	max := 1
+	if param := ctx.QueryParam("max"); param != "" {
+		if max, err = strconv.Atoi(param); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		if max < 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "max is out of range")
+		}
+	}
+
+	worker := h.Crawler.Worker(domain)
+	if worker == nil {
+		return ctx.NoContent(http.StatusNotFound)
+	}
+
+	return ctx.JSON(http.StatusOK, worker.RedirectChains(max))
+}
+
+// GetDomainGraphHandler is the api.Handler to query the link graph
+// of a domain's current run; unlike the tree, every link between two
+// pages is an edge, and every node has its in-link counts. the domain
+// is expected in the URL path, such as
+// /domains/https%3A%2F%2Fcloudflare.com/graph
+func (h *Handler) GetDomainGraphHandler(ctx echo.Context) error {
+	domain, err := url.PathUnescape(ctx.Param("domain"))
+	if err != nil {
+		ctx.Logger().Errorf("failed to unescape domain, %v\n", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	worker := h.Crawler.Worker(domain)
+	if worker == nil {
+		return ctx.NoContent(http.StatusNotFound)
+	}
+
+	return ctx.JSON(http.StatusOK, worker.Graph)
+}
+
+// GetDomainExportHandler is the api.Handler to download the link graph
+// of a domain's crawl, once complete; the domain is expected in the URL
+// path parameter and the format in the query, such as
+// /domains/https%3A%2F%2Fcloudflare.com/export?format=graphml
+//
+// format - string, required; graphml, dot, csv (edge list) or jsonl
+func (h *Handler) GetDomainExportHandler(ctx echo.Context) error {
+	domain, err := url.PathUnescape(ctx.Param("domain"))
+	if err != nil {
+		ctx.Logger().Errorf("failed to unescape domain, %v\n", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	format := ctx.QueryParam("format")
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, crawler.ErrUnsupportedFormat.Error())
+	}
+
+	worker := h.Crawler.Worker(domain)
+	if worker == nil {
+		return ctx.NoContent(http.StatusNotFound)
+	}
+
+	if worker.Status() != crawler.StatusFetchingComplete {
+		return ctx.NoContent(http.StatusNoContent)
+	}
+
+	resp := ctx.Response()
+	resp.Header().Set(echo.HeaderContentType, contentType)
+	resp.Header().Set(echo.HeaderContentDisposition, "attachment; filename=\"crawl."+format+"\"")
+	resp.WriteHeader(http.StatusOK)
+
+	// the headers are sent, an error can only be logged
+	if err = worker.Export(resp, format); err != nil {
+		ctx.Logger().Errorf("failed to export domain; error: %v\n", err.Error())
+	}
+
+	return nil
+}
+
+// GetDomainArchiveHandler is the api.Handler to download the WARC file
+// of a crawl run of an archived domain; the domain is expected in the
+// URL path parameter and the run number in the query, such as
+// /domains/https%3A%2F%2Fcloudflare.com/archive?run=1
+//
+// run - int, optional; defaults to the current run
+func (h *Handler) GetDomainArchiveHandler(ctx echo.Context) error {
+	domain, err := url.PathUnescape(ctx.Param("domain"))
+	if err != nil {
+		ctx.Logger().Errorf("failed to unescape domain, %v\n", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	worker := h.Crawler.Worker(domain)
+	if worker == nil {
+		return ctx.NoContent(http.StatusNotFound)
+	}
+
+	run := worker.Run()
+	if param := ctx.QueryParam("run"); param != "" {
+		if run, err = strconv.Atoi(param); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	path := h.Crawler.ArchivePath(domain, run)
+	if _, err = os.Stat(path); err != nil {
+		return ctx.NoContent(http.StatusNotFound)
+	}
+
+	return ctx.Attachment(path, "crawl-"+strconv.Itoa(run)+".warc.gz")
+}
+
+// writeEvent writes a Server-Sent Event & flushes it to the client
+func writeEvent(resp *echo.Response, name string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	if _, err = fmt.Fprintf(resp, "event: %s\ndata: %s\n\n", name, payload); err != nil {
+		return err
+	}
+
+	resp.Flush()
+	return nil
+}
+
+// GetDomainEventsHandler is the api.Handler to stream the resources
+// of a domain's crawl as Server-Sent Events, as soon as each one is
+// fetched; the domain is expected in the URL path parameter, such as
+// /domains/https%3A%2F%2Fcloudflare.com/events
+//
+// the resources fetched before the request are sent first, then a
+// `resource` event per fetched resource and a terminal `complete`
+// event with the status of the crawl. a client which falls behind
+// is disconnected, and is expected to reconnect
+func (h *Handler) GetDomainEventsHandler(ctx echo.Context) error {
+	domain, err := url.PathUnescape(ctx.Param("domain"))
+	if err != nil {
+		ctx.Logger().Errorf("failed to unescape domain, %v\n", err)
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	worker := h.Crawler.Worker(domain)
+	if worker == nil {
+		return ctx.NoContent(http.StatusNotFound)
+	}
+
+	sub := worker.Subscribe()
+	defer sub.Close()
+
+	resp := ctx.Response()
+	resp.Header().Set(echo.HeaderContentType, "text/event-stream")
+	resp.Header().Set("Cache-Control", "no-cache")
+	resp.Header().Set("Connection", "keep-alive")
+	resp.WriteHeader(http.StatusOK)
+
+	send := func(e *crawler.Event) error {
+		return writeEvent(resp, "resource", e)
+	}
+
+	for _, e := range sub.History {
+		if err = send(e); err != nil {
+			return nil
+		}
+	}
+
+	resp.Flush()
+	for {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				return nil
+			}
+
+			if err = send(e); err != nil {
+				return nil
+			}
+
+		case <-worker.Done():
+			// the resources are published before the
+			// crawl is done, drain the buffered ones
+			for drained := false; !drained; {
+				select {
+				case e, ok := <-sub.C:
+					if ok && send(e) == nil {
+						continue
+					}
+
+					drained = true
+				default:
+					drained = true
+				}
+			}
+
+			return writeEvent(resp, "complete", &Domain{
+				Domain:  domain,
+				Status:  worker.Status(),
+				Depth:   worker.CrawlDepth(),
+				Run:     worker.Run(),
+				Pending: worker.Pending(),
+			})
+
+		case <-ctx.Request().Context().Done():
+			return nil
+		}
+	}
+}
@@ -2,8 +2,10 @@ package api
 
 // module deps
 import "bytes"
+import "strings"
 import "context"
 import "testing"
+import "net/url"
 import "net/http"
 import "io/ioutil"
 import "encoding/json"
@@ -162,6 +164,30 @@ func TestBadRequest2CreateDomain(t *testing.T) {
 	}
 }
 
+// test 400 handler
+func TestBadRequest3CreateDomain(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	// create test server
+	server := NewTestServer()
+	defer server.Close()
+	server.mux.POST("/", server.handler.CreateDomainHandler)
+
+	// unknown politeness mode
+	domain := &Domain{Domain: "http://cloudflare.com", Politeness: "eager"}
+	buf := new(bytes.Buffer)
+	json.NewEncoder(buf).Encode(domain)
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/", buf)
+	req.Header.Add("Content-Type", "application/json")
+	server.mux.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("Got Non-400 response: %d\n", resp.Code)
+	}
+}
+
 // test 415 handler
 func TestUnSupportedMediaTypeRequestCreateDomain(t *testing.T) {
 	// execute test in parallel
@@ -286,3 +312,137 @@ func TestBadRequestGetDomainStatusHandler(t *testing.T) {
 		t.Fatalf("Got Non-200 response: %d\n", resp.Code)
 	}
 }
+
+// test 404 handler
+func TestBadRequestDeleteDomainHandler(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	// create test server
+	server := NewTestServer()
+	defer server.Close()
+	server.mux.DELETE("/domains/:domain", server.handler.DeleteDomainHandler)
+
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodDelete, "/domains/https%3A%2F%2Fcloudflare.com", nil)
+	server.mux.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("Got Non-404 response: %d\n", resp.Code)
+	}
+}
+
+// test events handler
+func TestGetDomainEventsHandler(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	// create test site
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("User-agent: *\nAllow: /\n"))
+		case "/":
+			w.Write([]byte(`<title>Home</title><a href="/a">A</a>`))
+		default:
+			w.Write([]byte(`<title>A</title>`))
+		}
+	}))
+	defer site.Close()
+
+	// create test server
+	server := NewTestServer()
+	defer server.Close()
+	server.mux.GET("/domains/:domain/events", server.handler.GetDomainEventsHandler)
+
+	domain := site.URL + "/"
+	if err := server.handler.Crawler.Crawl(domain, 2); err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/domains/"+url.PathEscape(domain)+"/events", nil)
+	server.mux.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Got Non-200 response: %d\n", resp.Code)
+	}
+
+	body := resp.Body.String()
+	if n := strings.Count(body, "event: resource\n"); n != 2 {
+		t.Fatalf("expected 2 resource events, got: %d\n", n)
+	}
+
+	if !strings.HasSuffix(body, "event: complete\ndata: {\"domain\":\""+domain+"\",\"depth\":2,\"status\":\"complete\",\"run\":1}\n\n") {
+		t.Fatalf("expected a complete event, got: %v\n", body)
+	}
+}
+
+// test the current run is not returned until it is complete
+func TestGetDomainSnapshotHandler(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	// create test site, whose home page waits to be released
+	release := make(chan struct{})
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: *\nAllow: /\n"))
+			return
+		}
+
+		<-release
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<title>Home</title>`))
+	}))
+	defer site.Close()
+
+	// create test server
+	server := NewTestServer()
+	defer server.Close()
+	server.mux.GET("/domains/:domain/snapshots/:id", server.handler.GetDomainSnapshotHandler)
+
+	domain := site.URL + "/"
+	if err := server.handler.Crawler.Crawl(domain, 1); err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/domains/"+url.PathEscape(domain)+"/snapshots/1", nil)
+	server.mux.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusNoContent {
+		t.Fatalf("Got Non-204 response: %d\n", resp.Code)
+	}
+
+	close(release)
+	<-server.handler.Crawler.Worker(domain).Done()
+
+	resp = httptest.NewRecorder()
+	server.mux.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"title":"Home"`) {
+		t.Fatalf("Got Non-200 response: %d, %v\n", resp.Code, resp.Body.String())
+	}
+}
+
+// test 400 handler
+func TestBadRequestGetDomainExportHandler(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	// create test server
+	server := NewTestServer()
+	defer server.Close()
+	server.mux.GET("/domains/:domain/export", server.handler.GetDomainExportHandler)
+
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/domains/https%3A%2F%2Fcloudflare.com/export?format=xls", nil)
+	server.mux.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("Got Non-400 response: %d\n", resp.Code)
+	}
+}
@@ -0,0 +1,227 @@
+package crawler
+
+// module deps
+import "sort"
+import "strings"
+import "net/url"
+
+// trailing slash policies
+const (
+	TrailingSlashKeep  = ""
+	TrailingSlashAdd   = "add"
+	TrailingSlashStrip = "strip"
+)
+
+// DefaultTrackingParams are the query parameters of the usual
+// analytics & ad click trackers
+var DefaultTrackingParams = []string{
+	"utm_*", "gclid", "dclid", "fbclid", "msclkid", "yclid",
+	"mc_cid", "mc_eid", "_ga", "_hsenc", "_hsmi", "igshid",
+}
+
+// Canonicalizer rewrites the URLs of a crawl to a canonical form
+// before they are deduplicated, so that the variants of a URL are
+// crawled once; a nil Canonicalizer leaves the URLs as they are
+type Canonicalizer struct {
+	// query parameters dropped, matched case insensitively;
+	// a trailing * matches any suffix, e.g. utm_*
+	StripParams []string
+
+	// sorts the query parameters
+	SortQuery bool
+
+	// lower cases the host, and the path for the sites
+	// which are served from a case insensitive filesystem
+	LowercaseHost bool
+	LowercasePath bool
+
+	// drops :80 from http URLs, and :443 from https URLs
+	RemoveDefaultPort bool
+
+	// decodes the percent-encoded unreserved characters,
+	// and upper cases the hex digits of the others
+	NormaliseEscapes bool
+
+	// keeps, adds or strips the trailing slash of a path;
+	// a slash is not added to a last segment with a dot
+	TrailingSlash string
+
+	// a page which names another URL in <link rel=canonical>
+	// is a duplicate of that URL, which is not fetched again
+	HonourCanonical bool
+}
+
+// DefaultCanonicalizer returns the canonicalizer of a new crawler;
+// every rule applies, but for the path's case & trailing slash
+func DefaultCanonicalizer() *Canonicalizer {
+	return &Canonicalizer{
+		StripParams:       DefaultTrackingParams,
+		SortQuery:         true,
+		LowercaseHost:     true,
+		RemoveDefaultPort: true,
+		NormaliseEscapes:  true,
+		TrailingSlash:     TrailingSlashKeep,
+		HonourCanonical:   true,
+	}
+}
+
+// Canonical returns the canonical form of an absolute URL, without
+// its fragment and with a path of / at least; the URL is not changed
+func (c *Canonicalizer) Canonical(u *url.URL) *url.URL {
+	canonical := *u
+	if c == nil {
+		return &canonical
+	}
+
+	canonical.Fragment, canonical.RawFragment = "", ""
+	if c.LowercaseHost {
+		canonical.Host = strings.ToLower(canonical.Host)
+	}
+
+	if c.RemoveDefaultPort {
+		port := canonical.Port()
+		if (canonical.Scheme == "http" && port == "80") || (canonical.Scheme == "https" && port == "443") {
+			canonical.Host = strings.TrimSuffix(canonical.Host, ":"+port)
+		}
+	}
+
+	if c.LowercasePath {
+		canonical.Path = strings.ToLower(canonical.Path)
+		canonical.RawPath = strings.ToLower(canonical.RawPath)
+	}
+
+	canonical.Path, canonical.RawPath = c.slash(canonical.Path), c.slash(canonical.RawPath)
+	if canonical.Path == "" {
+		canonical.Path, canonical.RawPath = "/", ""
+	}
+
+	if c.NormaliseEscapes {
+		canonical.RawPath = normaliseEscapes(canonical.RawPath)
+	}
+
+	canonical.RawQuery = c.query(canonical.RawQuery)
+	canonical.ForceQuery = false
+	return &canonical
+}
+
+// slash applies the trailing slash policy to a path
+func (c *Canonicalizer) slash(path string) string {
+	if path == "" || path == "/" {
+		return path
+	}
+
+	switch c.TrailingSlash {
+	case TrailingSlashAdd:
+		segment := path[strings.LastIndex(path, "/")+1:]
+		if segment != "" && !strings.Contains(segment, ".") {
+			return path + "/"
+		}
+	case TrailingSlashStrip:
+		return strings.TrimRight(path, "/")
+	}
+
+	return path
+}
+
+// query drops the stripped parameters of a raw query, and sorts
+// the others when required; the parameters are not re-encoded
+func (c *Canonicalizer) query(raw string) string {
+	if raw == "" {
+		return raw
+	}
+
+	params := make([]string, 0)
+	for _, param := range strings.Split(raw, "&") {
+		if param == "" {
+			continue
+		}
+
+		key := param
+		if i := strings.IndexByte(param, '='); i >= 0 {
+			key = param[:i]
+		}
+
+		if unescaped, err := url.QueryUnescape(key); err == nil {
+			key = unescaped
+		}
+
+		if c.strips(key) {
+			continue
+		}
+
+		if c.NormaliseEscapes {
+			param = normaliseEscapes(param)
+		}
+
+		params = append(params, param)
+	}
+
+	if c.SortQuery {
+		sort.Strings(params)
+	}
+
+	return strings.Join(params, "&")
+}
+
+// strips reports if the query parameter is dropped
+func (c *Canonicalizer) strips(key string) bool {
+	key = strings.ToLower(key)
+	for _, pattern := range c.StripParams {
+		pattern = strings.ToLower(pattern)
+		if strings.HasSuffix(pattern, "*") && strings.HasPrefix(key, strings.TrimSuffix(pattern, "*")) {
+			return true
+		}
+
+		if key == pattern {
+			return true
+		}
+	}
+
+	return false
+}
+
+// unhex returns the value of a hex digit, or -1
+func unhex(c byte) int {
+	switch {
+	case '0' <= c && c <= '9':
+		return int(c - '0')
+	case 'a' <= c && c <= 'f':
+		return int(c - 'a' + 10)
+	case 'A' <= c && c <= 'F':
+		return int(c - 'A' + 10)
+	}
+
+	return -1
+}
+
+// isUnreserved reports if the character need not be escaped
+// @see https://tools.ietf.org/html/rfc3986#section-2.3
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-._~", c) >= 0
+}
+
+// normaliseEscapes decodes the escaped unreserved characters of
+// an URL component, and upper cases the hex digits of the others
+func normaliseEscapes(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && unhex(s[i+1]) >= 0 && unhex(s[i+2]) >= 0 {
+			if c := byte(unhex(s[i+1])<<4 | unhex(s[i+2])); isUnreserved(c) {
+				b.WriteByte(c)
+			} else {
+				b.WriteString(strings.ToUpper(s[i : i+3]))
+			}
+
+			i += 2
+			continue
+		}
+
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
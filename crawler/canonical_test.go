@@ -0,0 +1,111 @@
+package crawler
+
+// module deps
+import "sync"
+import "testing"
+import "net/url"
+import "net/http"
+import "net/http/httptest"
+
+// test the rules of the canonicalizer
+func TestCanonical(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	strip := DefaultCanonicalizer()
+	strip.TrailingSlash = TrailingSlashStrip
+	strip.LowercasePath = true
+
+	add := DefaultCanonicalizer()
+	add.TrailingSlash = TrailingSlashAdd
+
+	tests := []struct {
+		c        *Canonicalizer
+		raw      string
+		expected string
+	}{
+		{nil, "http://Example.com:80/a?utm_source=x#top", "http://Example.com:80/a?utm_source=x#top"},
+		{DefaultCanonicalizer(), "http://Example.COM:80", "http://example.com/"},
+		{DefaultCanonicalizer(), "https://example.com:443/a?b=2&utm_Source=x&a=1&fbclid=y#top", "https://example.com/a?a=1&b=2"},
+		{DefaultCanonicalizer(), "https://example.com:8443/a", "https://example.com:8443/a"},
+		{DefaultCanonicalizer(), "http://example.com/%7euser/a%2fb?q=%7e%2f", "http://example.com/~user/a%2Fb?q=~%2F"},
+		{DefaultCanonicalizer(), "http://example.com/a/", "http://example.com/a/"},
+		{strip, "http://example.com/A/B/", "http://example.com/a/b"},
+		{strip, "http://example.com/", "http://example.com/"},
+		{add, "http://example.com/a", "http://example.com/a/"},
+		{add, "http://example.com/a.html", "http://example.com/a.html"},
+	}
+
+	for _, test := range tests {
+		u, _ := url.Parse(test.raw)
+		if canonical := test.c.Canonical(u).String(); canonical != test.expected {
+			t.Fatalf("expected %v for %v, got: %v\n", test.expected, test.raw, canonical)
+		}
+
+		if u.String() != test.raw {
+			t.Fatalf("expected %v to be left as is, got: %v\n", test.raw, u.String())
+		}
+	}
+}
+
+// test the variants of a URL are fetched once, and a page naming a
+// fetched URL as canonical is a duplicate whose links are recorded,
+// but not followed
+func TestCrawlCanonical(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	var mu sync.Mutex
+	fetched := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetched[r.URL.Path]++
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nAllow: /\n"))
+		case "/":
+			w.Write([]byte(`<title>Home</title><a href="/">Home</a><a href="/a?utm_source=x">A</a><a href="/%61">A</a>`))
+		case "/a":
+			w.Write([]byte(`<title>A</title><a href="/b">B</a>`))
+		case "/b":
+			w.Write([]byte(`<title>B</title><link rel="canonical" href="/a"><a href="/c">C</a>`))
+		default:
+			w.Write([]byte(`<title>C</title>`))
+		}
+	}))
+	defer server.Close()
+
+	c := New()
+	defer c.Close()
+
+	if err := c.Crawl(server.URL, 5); err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	worker := c.Worker(server.URL)
+	<-worker.Done()
+
+	if fetched["/"] != 1 || fetched["/a"] != 1 || fetched["/b"] != 1 || fetched["/c"] != 0 {
+		t.Fatalf("expected every page once, but /c, got: %v\n", fetched)
+	}
+
+	if worker.Tree.URLString != server.URL+"/" || worker.Tree.RawURL != server.URL || len(worker.Tree.Nodes) != 1 {
+		t.Fatalf("expected the canonical seed with 1 node, got: %v, %v\n", worker.Tree.URLString, worker.Tree.Nodes)
+	}
+
+	a := worker.Tree.Nodes[0]
+	if raw := a.RawURL; a.URLString != server.URL+"/a" || (raw != server.URL+"/a?utm_source=x" && raw != server.URL+"/%61") || len(a.Nodes) != 1 {
+		t.Fatalf("expected /a as linked, got: %v as %v\n", a.URLString, a.RawURL)
+	}
+
+	if b := a.Nodes[0]; b.Canonical != server.URL+"/a" || len(b.Nodes) != 0 {
+		t.Fatalf("expected /b to be a duplicate of /a, got: %v\n", b.Canonical)
+	}
+
+	if edges := a.Nodes[0].links; len(edges) != 1 || edges[0].Source != server.URL+"/b" || edges[0].Target != server.URL+"/c" {
+		t.Fatalf("expected the link of /b to /c to be recorded, got: %v\n", edges)
+	}
+}
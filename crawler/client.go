@@ -0,0 +1,167 @@
+package crawler
+
+// module deps
+import "io"
+import "net"
+import "sync"
+import "time"
+import "errors"
+import "context"
+import "net/http"
+
+// ErrReadTimeout is used when a server stalls for longer than
+// the read timeout, before or while sending the response
+var ErrReadTimeout = errors.New("read timeout")
+
+// bytes of a body that http.DetectContentType considers
+const sniffLen = 512
+
+// httpClient returns the client of a crawl; that is a copy of the
+// crawler's client, with the crawl's connect timeout when its
+// transport is a *http.Transport, since other transports cannot
+// be configured
+func (c *Crawler) httpClient(opts Options) *http.Client {
+	client := *c.HTTPClient
+	transport, ok := c.HTTPClient.Transport.(*http.Transport)
+	if c.HTTPClient.Transport == nil {
+		transport, ok = http.DefaultTransport.(*http.Transport)
+	}
+
+	if !ok || opts.ConnectTimeout <= 0 {
+		return &client
+	}
+
+	dialer := &net.Dialer{Timeout: opts.ConnectTimeout, KeepAlive: 30 * time.Second}
+	transport = transport.Clone()
+	transport.DialContext = dialer.DialContext
+	transport.TLSHandshakeTimeout = opts.ConnectTimeout
+
+	client.Transport = transport
+	return &client
+}
+
+// stallTimer cancels a request once it stalls for the read timeout
+type stallTimer struct {
+	// mutex
+	mu sync.Mutex
+
+	// fires after the read timeout
+	timer *time.Timer
+
+	// set once fired
+	stalled bool
+}
+
+// stalledErr returns ErrReadTimeout in place of the error caused by
+// the cancellation of a stalled request
+func (s *stallTimer) stalledErr(err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stalled && err != nil && err != io.EOF {
+		return ErrReadTimeout
+	}
+
+	return err
+}
+
+// timeoutBody resets the stall timer on every read, and
+// releases the request's context once closed
+type timeoutBody struct {
+	io.ReadCloser
+	stall   *stallTimer
+	timeout time.Duration
+	cancel  context.CancelFunc
+}
+
+// Read definition for timeoutBody
+func (b *timeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && b.stall.timer != nil {
+		b.stall.timer.Reset(b.timeout)
+	}
+
+	return n, b.stall.stalledErr(err)
+}
+
+// Close definition for timeoutBody
+func (b *timeoutBody) Close() error {
+	if b.stall.timer != nil {
+		b.stall.timer.Stop()
+	}
+
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// do sends the request with the worker's client, bounded by the
+// request timeout overall, and by the read timeout between the
+// request & the response, and between two reads of the body
+func (w *Worker) do(req *http.Request) (*http.Response, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if w.opts.RequestTimeout > 0 {
+		ctx, cancel = context.WithTimeout(req.Context(), w.opts.RequestTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(req.Context())
+	}
+
+	stall := &stallTimer{}
+	if w.opts.ReadTimeout > 0 {
+		stall.timer = time.AfterFunc(w.opts.ReadTimeout, func() {
+			stall.mu.Lock()
+			stall.stalled = true
+			stall.mu.Unlock()
+			cancel()
+		})
+	}
+
+	resp, err := w.client.Do(req.WithContext(ctx))
+	if err != nil {
+		if stall.timer != nil {
+			stall.timer.Stop()
+		}
+
+		cancel()
+		return nil, stall.stalledErr(err)
+	}
+
+	resp.Body = &timeoutBody{ReadCloser: resp.Body, stall: stall, timeout: w.opts.ReadTimeout, cancel: cancel}
+	return resp, nil
+}
+
+// limitedBody reads a body up to a max number of bytes, and
+// records whether the body was longer
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+	truncated bool
+}
+
+// Read definition for limitedBody
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		// probe for a byte past the limit
+		n, _ := b.ReadCloser.Read(make([]byte, 1))
+		b.truncated = b.truncated || n > 0
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+// limitBody arranges for the body of the response to be read up
+// to max bytes; a max of 0 is unbounded
+func limitBody(resp *http.Response, max int64) {
+	if max <= 0 || resp.Body == nil {
+		return
+	}
+
+	resp.Body = &limitedBody{ReadCloser: resp.Body, remaining: max}
+}
@@ -0,0 +1,50 @@
+package crawler
+
+// module deps
+import "time"
+import "testing"
+import "net/http"
+import "net/http/httptest"
+
+// test a server that stalls is recorded as a read timeout
+func TestReadTimeout(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nAllow: /\n"))
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<title>Home</title><a href="/slow">Slow</a>`))
+		default:
+			select {
+			case <-r.Context().Done():
+			case <-release:
+			}
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	c := New()
+	defer c.Close()
+
+	opts := Options{Depth: 2, ReadTimeout: 50 * time.Millisecond}
+	if err := c.CrawlWithOptions(server.URL+"/", opts); err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	worker := c.Worker(server.URL + "/")
+	select {
+	case <-worker.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected crawl to complete, pending: %d\n", worker.Pending())
+	}
+
+	if len(worker.Tree.Nodes) != 1 || worker.Tree.Nodes[0].Kind != KindError || worker.Tree.Nodes[0].Error != ErrReadTimeout.Error() {
+		t.Fatalf("expected a read timeout, got: %v\n", worker.Tree.Nodes)
+	}
+}
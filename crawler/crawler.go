@@ -7,12 +7,12 @@ import "log"
 import "mime"
 import "sync"
 import "time"
+import "bufio"
+import "context"
 import "errors"
 import "net/url"
 import "net/http"
-import "golang.org/x/net/html"
 import "github.com/temoto/robotstxt-go"
-import "github.com/jackdanger/collectlinks"
 
 // constants
 const (
@@ -22,6 +22,34 @@ const (
 	// max crawl depth
 	DefaultMaxCrawlDepth = 5
 
+	// previous runs retained per domain
+	DefaultMaxSnapshots = 10
+
+	// interval between two checkpoints of the frontiers
+	DefaultCheckpointInterval = 30 * time.Second
+
+	// per-request timeouts of a crawl: overall, to connect
+	// and between two reads of a response
+	DefaultRequestTimeout = 60 * time.Second
+	DefaultConnectTimeout = 10 * time.Second
+	DefaultReadTimeout    = 30 * time.Second
+
+	// floor & ceiling applied to the robots.txt Crawl-delay
+	DefaultMinCrawlDelay = 0 * time.Second
+	DefaultMaxCrawlDelay = 60 * time.Second
+
+	// requests in flight to a host, when adaptive
+	DefaultMaxHostConcurrency = 4
+
+	// least delay an adaptive crawl backs off by
+	AdaptiveDelayStep = 250 * time.Millisecond
+
+	// bytes of a response body that are read
+	DefaultMaxBodySize = 10 << 20
+
+	// hops of a redirect chain that are followed
+	DefaultMaxRedirects = 10
+
 	// default compliance level with robots.txt policy
 	// @see https://moz.com/learn/seo/robotstxt
 	DefaultComplyWithRobotPolicy = true
@@ -36,21 +64,19 @@ var robotsTxtParsedPath, _ = url.Parse("/robots.txt")
 // ErrDomainAlreadyRegistered is used when domain already exists
 var ErrDomainAlreadyRegistered = errors.New("domain is already registered/crawled")
 
+// ErrDomainNotRegistered is used when domain does not exist
+var ErrDomainNotRegistered = errors.New("domain is not registered")
+
 // normalises relative URLs to absolute URLs
-// checks that the link belongs to the parent domain
+// the hosts that are crawled are up to the scope
 func normaliseURL(href string, base *url.URL) *url.URL {
 	uri, err := url.Parse(href)
 	if err != nil {
 		return nil
 	}
 
-	// if the link belongs to a different domain
-	// we do not want to normalise / crawl the link
-	if uri.Host != "" && uri.Host != base.Host {
-		return nil
-	}
-
 	uri = base.ResolveReference(uri)
+	uri.Fragment = ""
 
 	if uri.Scheme != "http" && uri.Scheme != "https" {
 		return nil
@@ -59,34 +85,24 @@ func normaliseURL(href string, base *url.URL) *url.URL {
 	return uri
 }
 
-// getTitleForPage parses the HTML and retrieves the `title` tag
-func getTitleForPage(doc io.ReadCloser) (string, error) {
-	titleTag := "title"
+// ResourceKind describes what a resource turned out to be
+type ResourceKind string
 
-	page := html.NewTokenizer(doc)
-	for {
-		tt := page.Next()
-		switch tt {
-		case html.ErrorToken:
-			return "", page.Err()
-		}
+// resource kinds
+const (
+	// a HTML document, whose links are followed
+	KindPage ResourceKind = "page"
 
-		token := page.Token()
-		switch token.Data {
-		case titleTag:
-			tt = page.Next()
-			switch tt {
-			case html.ErrorToken:
-				return "", page.Err()
-			case html.TextToken:
-				token = page.Token()
-				return token.Data, nil
-			}
-		}
-	}
+	// any other content type, such as images or PDFs
+	KindAsset ResourceKind = "asset"
 
-	return "", nil
-}
+	// a fetch that failed, or responded 4xx / 5xx
+	KindError ResourceKind = "error"
+
+	// a redirect out of the crawl's scope, which is not followed,
+	// or to a resource which is crawled on its own
+	KindRedirect ResourceKind = "redirect"
+)
 
 // Resource describes a web page and it's nodes
 type Resource struct {
@@ -94,22 +110,57 @@ type Resource struct {
 	sync.Mutex
 
 	// resource URL
-	URL *url.URL `json:"_"`
+	URL *url.URL `json:"-"`
 
 	// string version
 	URLString string `json:"url"`
 
+	// as linked, before it was canonicalised
+	RawURL string `json:"raw_url,omitempty"`
+
+	// from <link rel=canonical>, when it names another URL
+	Canonical string `json:"canonical,omitempty"`
+
 	// from meta
 	Title string `json:"title"`
 
 	// HTTP StatusCode
 	HTTPStatusCode int `json:"status"`
 
+	// page, asset, redirect or error
+	Kind ResourceKind `json:"kind,omitempty"`
+
+	// from the response headers; the length is 0 when unknown
+	ContentType   string `json:"content_type,omitempty"`
+	ContentLength int64  `json:"content_length,omitempty"`
+
+	// transport error or HTTP status of a failed fetch
+	Error string `json:"error,omitempty"`
+
+	// requests made, including the retries
+	Attempts int `json:"attempts,omitempty"`
+
+	// redirects followed, or not, and the URL they led to
+	Redirects []Redirect `json:"redirects,omitempty"`
+	FinalURL  string     `json:"final_url,omitempty"`
+
+	// of the visible text of a page, and the page crawled
+	// already that it is a near-duplicate of, if skipped
+	SimHash     uint64 `json:"simhash,string,omitempty"`
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+
+	// from the meta robots tag & the X-Robots-Tag header; the
+	// title & SimHash of a noindex page are not recorded, and
+	// the links of a nofollow page are not followed, unless
+	// the crawl is an audit
+	NoIndex  bool `json:"noindex,omitempty"`
+	NoFollow bool `json:"nofollow,omitempty"`
+
 	// root node
-	Root *url.URL `json:"_"`
+	Root *url.URL `json:"-"`
 
 	// parent node ancestry
-	Parent []string `json:"_"`
+	Parent []string `json:"-"`
 
 	// current depth
 	Depth int `json:"depth"`
@@ -118,20 +169,41 @@ type Resource struct {
 	Nodes []*Resource `json:"nodes"`
 
 	// last fetched timestamp
-	LastFetched time.Time `json:"_"`
+	LastFetched time.Time `json:"-"`
+
+	// links found on the page, to resources of the domain
+	links []Edge
+
+	// owning worker
+	worker *Worker
+
+	// taken off a persisted frontier, and already
+	// marked visited by the run that was interrupted
+	resumed bool
 }
 
 // Queue is a task queue for crawlers
 type Queue struct {
-	// track the state of queue, so workers
+	// closed along with the queue, so workers
 	// need not try to receive tasks from a
 	// closed channel, thus avoiding panics
-	closed bool
+	closed chan struct{}
 
 	// work channel
 	ch chan *Resource
 }
 
+// isClosed reports if the queue is closed; it is
+// safe for concurrent use by multiple goroutines
+func (q *Queue) isClosed() bool {
+	select {
+	case <-q.closed:
+		return true
+	default:
+		return false
+	}
+}
+
 // Logger defines the logging interface
 type Logger interface {
 	SetOutput(w io.Writer)
@@ -147,9 +219,13 @@ type Logger interface {
 // Crawler is a collection of workers
 // that crawl their respective domains
 type Crawler struct {
-	// mutex
+	// mutex of the registry, never held during I/O
 	sync.Mutex
 
+	// serialises the writes of the workers to the
+	// store with their removal from the store
+	persist sync.Mutex
+
 	// user agent to send
 	UserAgent string
 
@@ -159,6 +235,34 @@ type Crawler struct {
 	// logger interface
 	Logger Logger
 
+	// bounds of the per-worker crawl delay
+	MinCrawlDelay time.Duration
+	MaxCrawlDelay time.Duration
+
+	// requests in flight to a host, when adaptive
+	MaxHostConcurrency int
+
+	// bytes of a response body that are read; 0 is unbounded
+	MaxBodySize int64
+
+	// hops of a redirect chain that are followed; 0 is unbounded
+	MaxRedirects int
+
+	// previous runs retained per domain; 0 is unbounded
+	MaxSnapshots int
+
+	// directory of the WARC files of archived crawls
+	ArchiveDir string
+
+	// retries of the failed requests of fetch
+	Retry RetryPolicy
+
+	// rewrites the URLs before they are deduplicated
+	Canonicalizer *Canonicalizer
+
+	// persists the workers' state; in memory by default
+	Store Store
+
 	// registered workers
 	workers map[string]*Worker
 
@@ -170,24 +274,65 @@ type Crawler struct {
 
 	// channel to listen for close event
 	stop chan chan error
+
+	// closed once the crawler is closed
+	done chan struct{}
 }
 
 // New returns a new crawler
 func New() *Crawler {
 	c := &Crawler{
-		UserAgent:  DefaultUserAgent,
-		HTTPClient: http.DefaultClient,
-		Logger:     log.New(os.Stderr, "gocrawler", log.LstdFlags),
-		stop:       make(chan chan error),
-		workers:    make(map[string]*Worker),
-		q:          &Queue{ch: make(chan *Resource, 100)},
-		throttle:   make(chan bool, DefaultThrottlingRate),
+		UserAgent:     DefaultUserAgent,
+		HTTPClient:    http.DefaultClient,
+		Logger:        log.New(os.Stderr, "gocrawler", log.LstdFlags),
+		MinCrawlDelay: DefaultMinCrawlDelay,
+		MaxCrawlDelay: DefaultMaxCrawlDelay,
+		MaxSnapshots:  DefaultMaxSnapshots,
+		Retry:         DefaultRetryPolicy(),
+		Canonicalizer: DefaultCanonicalizer(),
+		Store:         NewMemoryStore(),
+		stop:          make(chan chan error),
+		done:          make(chan struct{}),
+		workers:       make(map[string]*Worker),
+		q:             &Queue{ch: make(chan *Resource, 100), closed: make(chan struct{})},
+		throttle:      make(chan bool, DefaultThrottlingRate),
+
+		MaxHostConcurrency: DefaultMaxHostConcurrency,
+		MaxBodySize:        DefaultMaxBodySize,
+		MaxRedirects:       DefaultMaxRedirects,
 	}
 
 	go c.loop()
+	go c.checkpoints(DefaultCheckpointInterval)
 	return c
 }
 
+// checkpoints periodically persists the frontiers of the
+// workers in flight, until the crawler is closed
+func (c *Crawler) checkpoints(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// under the persist lock, so that a worker
+			// cannot be removed from the store while it
+			// is saved, rather than the registry's
+			c.persist.Lock()
+			for _, worker := range c.registered() {
+				if worker.ctx.Err() == nil {
+					worker.checkpoint()
+				}
+			}
+
+			c.persist.Unlock()
+		case <-c.done:
+			return
+		}
+	}
+}
+
 // loop listens for channel events and
 // sends them to get enqueued and processed
 func (c *Crawler) loop() {
@@ -196,9 +341,11 @@ func (c *Crawler) loop() {
 		case resource := <-c.q.ch:
 			c.enqueue(resource)
 		case errc := <-c.stop:
+			// q.ch is left open, senders blocked
+			// on it give up when their worker is
+			// stopped, rather than panic on send
 			close(c.stop)
-			c.q.closed = true
-			close(c.q.ch)
+			close(c.q.closed)
 			errc <- nil
 			return // we're done
 		}
@@ -219,20 +366,85 @@ func (c *Crawler) Close() error {
 
 	// wait for close to complete
 	log.Println("[WARN] listeners shut down, waiting for crawlers to drain")
-	for _, worker := range c.workers {
-		worker.Wait()
+	c.persist.Lock()
+	for _, worker := range c.registered() {
+		// the crawl is resumed once the crawler restarts
+		worker.stop(StatusFetchingInProgress)
+		worker.checkpoint()
+	}
+	c.persist.Unlock()
+
+	close(c.done)
+	err := <-errc
+	if serr := c.Store.Close(); err == nil {
+		err = serr
 	}
 
 	log.Println("[WARN] shut down complete, exiting")
-	return <-errc
+	return err
+}
+
+// schedule hands a resource, already pushed onto the worker's
+// frontier, to the queue; if the worker is stopped first the
+// resource is taken off the frontier instead
+func (c *Crawler) schedule(resource *Resource) {
+	worker := resource.worker
+	select {
+	case c.q.ch <- resource:
+	case <-worker.ctx.Done():
+		worker.pop(resource)
+	}
 }
 
 // Worker returns worker for a given domain
 func (c *Crawler) Worker(domain string) *Worker {
+	c.Lock()
+	defer c.Unlock()
+
 	worker, _ := c.workers[domain]
 	return worker
 }
 
+// registered returns the registered workers
+func (c *Crawler) registered() []*Worker {
+	c.Lock()
+	defer c.Unlock()
+
+	workers := make([]*Worker, 0, len(c.workers))
+	for _, worker := range c.workers {
+		workers = append(workers, worker)
+	}
+
+	return workers
+}
+
+// Cancel stops the crawl of a given domain; the requests in
+// flight are cancelled, its goroutines are drained and then
+// the worker is removed from the registry, so that it can be
+// crawled again. the WARC files of its runs are kept, but are
+// moved aside to <domain>/deleted/<time> in the archive directory
+func (c *Crawler) Cancel(domain string) error {
+	c.Lock()
+	worker, exists := c.workers[domain]
+	if !exists {
+		c.Unlock()
+		return ErrDomainNotRegistered
+	}
+
+	delete(c.workers, domain)
+	c.Unlock()
+
+	worker.stop(StatusCancelled)
+	if err := c.retireArchive(domain); err != nil {
+		log.Printf("[ERROR] failed to move archive aside: %v, error: %v\n", domain, err)
+	}
+
+	c.persist.Lock()
+	defer c.persist.Unlock()
+
+	return c.Store.DeleteWorker(domain)
+}
+
 // recursively finds the correct leaf for
 // the node to be added under the root node
 func addNode(parent, child *Resource) error {
@@ -252,95 +464,523 @@ func addNode(parent, child *Resource) error {
 	return nil
 }
 
-// append adds a node to the list at the correct
-// leaf in the tree belonging to the root node
+// append persists a fetched resource, adds it to the
+// tree belonging to the root node & publishes it
 func (c *Crawler) append(resource *Resource) {
-	worker, _ := c.workers[resource.Root.String()]
-	if worker.Tree == nil {
-		worker.Tree = resource
-		return
+	worker := resource.worker
+	record := resource.record()
+	if err := worker.store.SaveResource(worker.seed.String(), record); err != nil {
+		log.Printf("[ERROR] failed to save resource: %v, error: %v\n", resource.URLString, err)
+	}
+
+	worker.attach(resource)
+	worker.Graph.add(record)
+	worker.publish(resource)
+}
+
+// crawlDelay determines the interval between two requests to
+// the same host; the robots.txt Crawl-delay, or the override
+// when provided, bounded by the crawler's floor and ceiling
+func (c *Crawler) crawlDelay(agent *robotstxt.Group, override time.Duration) time.Duration {
+	delay := agent.CrawlDelay
+	if override > 0 {
+		delay = override
 	}
 
-	worker.Tree.Lock()
-	defer worker.Tree.Unlock()
-	worker.LastUpdated = time.Now()
+	if delay < c.MinCrawlDelay {
+		delay = c.MinCrawlDelay
+	}
 
-	// insert children at depth > 1
-	if len(resource.Parent) == 1 && resource.Parent[0] == worker.Tree.URL.String() {
-		worker.Tree.Nodes = append(worker.Tree.Nodes, resource)
-		return
+	if c.MaxCrawlDelay > 0 && delay > c.MaxCrawlDelay {
+		delay = c.MaxCrawlDelay
 	}
 
-	addNode(worker.Tree, resource)
+	return delay
+}
+
+// politeness returns the limiter of a crawl; static at the crawl
+// delay, or adaptive between the crawl delay & the crawler's
+// ceiling, DefaultMaxCrawlDelay when it has none
+func (c *Crawler) politeness(agent *robotstxt.Group, opts Options) *limiter {
+	delay := c.crawlDelay(agent, opts.CrawlDelay)
+	if opts.Politeness != PolitenessAdaptive {
+		return newLimiter(delay)
+	}
+
+	ceiling := c.MaxCrawlDelay
+	if ceiling <= 0 {
+		ceiling = DefaultMaxCrawlDelay
+	}
+
+	concurrency := c.MaxHostConcurrency
+	if concurrency <= 0 {
+		concurrency = DefaultMaxHostConcurrency
+	}
+
+	return newAdaptiveLimiter(delay, ceiling, concurrency)
 }
 
 // Crawl initialises crawler by looking up robots.txt
 // and then seeds the queue with a initial resource
 func (c *Crawler) Crawl(rawurl string, depth int) error {
-	c.Lock()
-	defer c.Unlock()
+	return c.CrawlWithOptions(rawurl, Options{Depth: depth})
+}
+
+// CrawlWithOptions is like Crawl, but allows the
+// per-crawl settings of the worker to be provided
+func (c *Crawler) CrawlWithOptions(rawurl string, opts Options) error {
+	return c.CrawlContext(context.Background(), rawurl, opts)
+}
 
+// CrawlContext is like CrawlWithOptions, but the crawl is bound to
+// the context; once it is done, the requests in flight are cancelled
+// and the crawl is marked cancelled, though it remains registered
+// along with the tree fetched so far
+func (c *Crawler) CrawlContext(ctx context.Context, rawurl string, opts Options) error {
 	u, err := url.Parse(rawurl)
 	if err != nil {
 		return err
 	}
 
-	if _, exists := c.workers[u.String()]; exists {
+	if err = opts.validate(); err != nil {
+		return err
+	}
+
+	// checked again once robots.txt is looked up
+	if c.Worker(u.String()) != nil {
 		return ErrDomainAlreadyRegistered
 	}
 
-	res, err := c.HTTPClient.Get(u.ResolveReference(robotsTxtParsedPath).String())
+	worker, err := c.start(ctx, u, opts, nil)
+	if err != nil {
+		return err
+	}
+
+	if ctx.Done() != nil {
+		go c.watch(ctx, worker)
+	}
+
+	return nil
+}
+
+// watch marks the crawl cancelled once its context is done
+func (c *Crawler) watch(ctx context.Context, worker *Worker) {
+	select {
+	case <-ctx.Done():
+	case <-worker.Done():
+	}
+
+	// the crawl is done, unless it is stopped by the context
+	if ctx.Err() == nil {
+		return
+	}
+
+	worker.stop(StatusCancelled)
+	if worker.Status() == StatusCancelled {
+		worker.save()
+	}
+}
+
+// Recrawl starts a fresh crawl of a registered domain with the
+// same settings; the run in flight, if any, is cancelled first
+// and the previous tree is retained as a numbered snapshot
+func (c *Crawler) Recrawl(domain string) error {
+	prev := c.Worker(domain)
+	if prev == nil {
+		return ErrDomainNotRegistered
+	}
+
+	prev.stop(StatusCancelled)
+	_, err := c.start(context.Background(), prev.seed, prev.opts, prev)
+	return err
+}
+
+// newWorker returns the first run of a worker for the URL, whose
+// crawl is cancelled along with the parent context; the seed is
+// the root of the tree from the start, so that resources enqueued
+// by sitemaps can never take its place, regardless of the fetch
+// order. robots.txt allows everything until it is looked up
+func (c *Crawler) newWorker(parent context.Context, u *url.URL, opts Options) *Worker {
+	if opts.Depth == 0 {
+		opts.Depth = DefaultMaxCrawlDepth
+	}
+
+	if opts.RequestTimeout == 0 {
+		opts.RequestTimeout = DefaultRequestTimeout
+	}
+
+	if opts.ConnectTimeout == 0 {
+		opts.ConnectTimeout = DefaultConnectTimeout
+	}
+
+	if opts.ReadTimeout == 0 {
+		opts.ReadTimeout = DefaultReadTimeout
+	}
+
+	// the patterns are validated by CrawlContext
+	filter, _ := newURLFilter(opts.Include, opts.Exclude)
+	scope := newScope(u, opts)
+
+	agent := &robotstxt.Group{}
+	ctx, cancel := context.WithCancel(parent)
+	worker := &Worker{
+		ctx:         ctx,
+		cancel:      cancel,
+		seed:        u,
+		opts:        opts,
+		agent:       agent,
+		client:      c.httpClient(opts),
+		store:       c.Store,
+		crawlDepth:  opts.Depth,
+		limiter:     c.politeness(agent, opts),
+		filter:      filter,
+		scope:       scope,
+		robots:      make(map[string]*hostRobots),
+		status:      StatusInitialised,
+		frontier:    make(map[*Resource]*ResourceRecord),
+		done:        make(chan struct{}),
+		subscribers: make(map[chan *Event]struct{}),
+		Graph:       NewGraph(),
+		run:         1,
+		started:     time.Now(),
+	}
+
+	if opts.SkipDuplicates {
+		worker.fingerprints = newSimIndex(DefaultSimHashDistance)
+	}
+
+	worker.client.CheckRedirect = c.checkRedirect(worker)
+
+	root := c.Canonicalizer.Canonical(u)
+	worker.Tree = &Resource{URL: root, URLString: root.String(), RawURL: u.String(), Depth: 1, Root: u, worker: worker}
+	return worker
+}
+
+// Load restores the workers persisted in the Store, along with
+// their trees & snapshots; it is meant to be called once, after
+// the Store is configured and before any crawl is started. the
+// crawls which were interrupted are resumed from their frontier
+func (c *Crawler) Load() error {
+	records, err := c.Store.LoadWorkers()
 	if err != nil {
 		return err
 	}
 
-	if res.Body != nil {
-		defer res.Body.Close()
+	for _, record := range records {
+		u, err := url.Parse(record.Domain)
+		if err != nil {
+			return err
+		}
+
+		// robots.txt is looked up again if the crawl resumes
+		worker := c.newWorker(context.Background(), u, record.Options)
+		worker.status = record.Status
+		worker.run = record.Run
+		worker.started = record.Started
+
+		if worker.snapshots, err = c.Store.LoadSnapshots(record.Domain); err != nil {
+			return err
+		}
+
+		resources, err := c.Store.LoadResources(record.Domain)
+		if err != nil {
+			return err
+		}
+
+		fetched := make(map[string]struct{}, len(resources))
+		for _, rr := range resources {
+			resource, err := rr.resource(worker)
+			if err != nil {
+				continue
+			}
+
+			worker.Graph.add(rr)
+			if worker.fingerprints != nil && rr.SimHash != 0 && rr.DuplicateOf == "" {
+				worker.fingerprints.add(rr.URL, rr.SimHash)
+			}
+
+			fetched[resource.URLString] = struct{}{}
+
+			// the seed is saved without ancestry
+			if len(resource.Parent) == 0 && resource.URLString == worker.Tree.URLString {
+				worker.Tree.Title = resource.Title
+				worker.Tree.HTTPStatusCode = resource.HTTPStatusCode
+				worker.Tree.Kind = resource.Kind
+				worker.Tree.ContentType = resource.ContentType
+				worker.Tree.ContentLength = resource.ContentLength
+				worker.Tree.Error = resource.Error
+				worker.Tree.Attempts = resource.Attempts
+				worker.Tree.Canonical = resource.Canonical
+				worker.Tree.Redirects = resource.Redirects
+				worker.Tree.FinalURL = resource.FinalURL
+				worker.Tree.SimHash = resource.SimHash
+				worker.Tree.DuplicateOf = resource.DuplicateOf
+				worker.Tree.NoIndex = resource.NoIndex
+				worker.Tree.NoFollow = resource.NoFollow
+				worker.Tree.LastFetched = resource.LastFetched
+				worker.fetched = append(worker.fetched, worker.Tree)
+				continue
+			}
+
+			worker.attach(resource)
+			worker.fetched = append(worker.fetched, resource)
+		}
+
+		c.Lock()
+		c.workers[record.Domain] = worker
+		c.Unlock()
+
+		if worker.status != StatusInitialised && worker.status != StatusFetchingInProgress {
+			worker.finish()
+			continue
+		}
+
+		if err = c.resume(worker, fetched); err != nil {
+			log.Printf("[ERROR] failed to resume crawl: %v, error: %v\n", record.Domain, err)
+			worker.setStatus(StatusFetchingError)
+			worker.save()
+			worker.finish()
+		}
+	}
+
+	return nil
+}
+
+// resume seeds the queue with the persisted frontier of an
+// interrupted crawl, minus the resources that were fetched;
+// robots.txt is looked up again, so the lock is not held
+func (c *Crawler) resume(worker *Worker, fetched map[string]struct{}) error {
+	if worker.opts.Archive {
+		archive, err := c.openArchive(worker.seed.String(), worker.run)
+		if err != nil {
+			return err
+		}
+
+		worker.archive = archive
 	}
 
-	robData, err := robotstxt.FromResponse(res)
+	robData, err := c.robots(worker)
 	if err != nil {
 		return err
 	}
 
-	agent := robData.FindGroup(c.UserAgent)
-	if agent == nil {
+	records, err := c.Store.LoadFrontier(worker.seed.String())
+	if err != nil {
 		return err
 	}
 
-	if depth == 0 {
-		depth = DefaultMaxCrawlDepth
-	}
-
-	c.workers[u.String()] = &Worker{
-		seed:       u,
-		agent:      agent,
-		crawlDepth: depth,
-		status:     StatusInitialised,
-		tracker:    make(map[string]struct{}),
-	}
-
-	go func(u string) {
-		worker, _ := c.workers[u]
-		delay := 15 * time.Second
-		ticker := time.NewTicker(delay)
-		for {
-			select {
-			case <-ticker.C:
-				if worker.LastUpdated.Add(delay).After(time.Now()) {
-					// there is no activity in the last 15 seconds
-					// so assume the fetch is complete; there is no
-					// other "better" way to determine this, because
-					// the race condition between adding a work to the
-					// WaitGroup and wg.Done is a lot flakier than this
-					worker.status = StatusFetchingComplete
-				}
-			}
+	worker.resumed = true
+
+	frontier := make([]*Resource, 0, len(records))
+	seen := make(map[string]struct{}, len(records))
+	for _, rr := range records {
+		if _, ok := fetched[rr.URL]; ok {
+			continue
+		}
+
+		if _, ok := seen[rr.URL]; ok {
+			continue
+		}
+
+		resource, err := rr.resource(worker)
+		if err != nil {
+			continue
+		}
+
+		// the seed is the root of the tree already
+		if resource.URLString == worker.Tree.URLString {
+			resource = worker.Tree
 		}
-	}(u.String())
+
+		seen[rr.URL] = struct{}{}
+		resource.resumed = true
+		frontier = append(frontier, resource)
+	}
+
+	// interrupted before the seed was even queued
+	if _, ok := fetched[worker.Tree.URLString]; !ok && len(frontier) == 0 {
+		worker.Tree.resumed = true
+		frontier = append(frontier, worker.Tree)
+	}
+
+	// the frontier is pending until scheduled, so
+	// that the crawl completes even if it is empty
+	if !worker.acquire() {
+		return nil
+	}
+
+	worker.push(nil)
+	for _, resource := range frontier {
+		worker.push(resource)
+	}
+
+	go func() {
+		defer worker.wg.Done()
+		defer worker.pop(nil)
+
+		for _, resource := range frontier {
+			c.schedule(resource)
+		}
+	}()
+
+	// the sitemaps are walked again, the visited set
+	// drops the locations that were already crawled
+	if worker.opts.UseSitemaps && worker.acquire() {
+		worker.push(nil)
+		go c.seedSitemaps(worker, robData.Sitemaps)
+	}
+
+	return nil
+}
+
+// fetchRobots looks up the robots.txt of the host of the URL
+func (c *Crawler) fetchRobots(worker *Worker, u *url.URL) (*robotstxt.RobotsData, error) {
+	req, err := http.NewRequest(http.MethodGet, u.ResolveReference(robotsTxtParsedPath).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := worker.do(req.WithContext(worker.ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	worker.archive.wrap(res)
+	defer res.Body.Close()
+
+	return robotstxt.FromResponse(res)
+}
+
+// robots looks up the robots.txt of the worker's seed, and
+// applies the group of rules for the crawler's user agent
+// along with its crawl delay
+func (c *Crawler) robots(worker *Worker) (*robotstxt.RobotsData, error) {
+	robData, err := c.fetchRobots(worker, worker.seed)
+	if err != nil {
+		return nil, err
+	}
+
+	worker.agent = robData.FindGroup(c.UserAgent)
+	worker.limiter = c.politeness(worker.agent, worker.opts)
+	return robData, nil
+}
+
+// permits reports if the robots.txt of the URL's host allows it to
+// be crawled. the seed's host is looked up as the crawl starts, any
+// other host in scope once, by the first fetch of one of its URLs,
+// rather than by enqueue on the crawler's loop; a host that cannot
+// be looked up is not crawled
+func (c *Crawler) permits(worker *Worker, u *url.URL) bool {
+	if u.Host == worker.seed.Host {
+		return worker.agent.Test(u.Path)
+	}
+
+	worker.mu.Lock()
+	robots, exists := worker.robots[u.Host]
+	if !exists {
+		robots = &hostRobots{}
+		worker.robots[u.Host] = robots
+	}
+	worker.mu.Unlock()
+
+	robots.once.Do(func() {
+		robData, err := c.fetchRobots(worker, u)
+		if err != nil {
+			log.Printf("[ERROR] failed to fetch robots.txt: %v, error: %v\n", u.Host, err)
+			robData, _ = robotstxt.FromStatusAndBytes(http.StatusServiceUnavailable, nil)
+		}
+
+		robots.agent = robData.FindGroup(c.UserAgent)
+	})
+
+	return robots.agent.Test(u.Path)
+}
+
+// start looks up robots.txt, registers a worker for the URL and
+// seeds the queue; when prev is provided, the new worker is its
+// next run and inherits its snapshots. robots.txt is looked up
+// without the lock, which is only taken to register the worker,
+// unless the domain was registered, or prev replaced, meanwhile
+func (c *Crawler) start(ctx context.Context, u *url.URL, opts Options, prev *Worker) (_ *Worker, err error) {
+	worker := c.newWorker(ctx, u, opts)
+	if prev != nil {
+		worker.run = prev.run + 1
+	}
+
+	// release the worker's context & archive, unless it is started
+	defer func() {
+		if err != nil {
+			worker.cancel()
+			worker.archive.close()
+		}
+	}()
+
+	if opts.Archive {
+		if worker.archive, err = c.openArchive(u.String(), worker.run); err != nil {
+			return nil, err
+		}
+	}
+
+	robData, err := c.robots(worker)
+	if err != nil {
+		return nil, err
+	}
+
+	if prev != nil {
+		worker.snapshots = append(prev.Snapshots(), prev.snapshot())
+		if c.MaxSnapshots > 0 && len(worker.snapshots) > c.MaxSnapshots {
+			worker.snapshots = worker.snapshots[len(worker.snapshots)-c.MaxSnapshots:]
+		}
+	}
+
+	// the worker is saved before it can be removed from the store
+	c.persist.Lock()
+	defer c.persist.Unlock()
+
+	if err = c.register(worker, prev); err != nil {
+		return nil, err
+	}
+
+	if prev != nil {
+		domain := u.String()
+		if err = c.Store.SaveSnapshot(domain, prev.snapshot(), c.MaxSnapshots); err != nil {
+			return nil, err
+		}
+
+		if err = c.Store.ClearRun(domain); err != nil {
+			return nil, err
+		}
+	}
+
+	worker.save()
 
 	// seed the crawler
-	c.q.ch <- &Resource{URL: u, URLString: u.String(), Depth: 1, Root: u}
+	worker.push(worker.Tree)
+	c.schedule(worker.Tree)
+
+	// the sitemaps are pending until walked,
+	// since they keep adding to the frontier
+	if opts.UseSitemaps && worker.acquire() {
+		worker.push(nil)
+		go c.seedSitemaps(worker, robData.Sitemaps)
+	}
+
+	return worker, nil
+}
+
+// register adds the worker to the registry, unless its domain is
+// registered already; or, when prev is provided, in place of prev
+// unless it lost a race with a concurrent Cancel / Recrawl
+func (c *Crawler) register(worker *Worker, prev *Worker) error {
+	c.Lock()
+	defer c.Unlock()
+
+	domain := worker.seed.String()
+	if c.workers[domain] != prev {
+		return ErrDomainAlreadyRegistered
+	}
+
+	c.workers[domain] = worker
 	return nil
 }
 
@@ -348,8 +988,22 @@ func (c *Crawler) Crawl(rawurl string, depth int) error {
 // validating that the resource is a valid URL &
 // that the robots.txt policy allows crawling it
 func (c *Crawler) enqueue(resource *Resource) {
+	worker := resource.worker
+	if worker == nil {
+		return
+	}
+
+	// a resource leaves the frontier unless it is
+	// dispatched, in which case fetch takes it out
+	dispatched := false
+	defer func() {
+		if !dispatched {
+			worker.pop(resource)
+		}
+	}()
+
 	// if queue is closed dont start new work
-	if c.q.closed {
+	if c.q.isClosed() {
 		return
 	}
 
@@ -357,12 +1011,12 @@ func (c *Crawler) enqueue(resource *Resource) {
 		return
 	}
 
-	worker, created := c.workers[resource.Root.String()]
-	if !created {
+	// the worker is gone when its crawl is cancelled
+	if worker.ctx.Err() != nil {
 		return
 	}
 
-	if worker.visited(resource.URL.String()) {
+	if worker.visited(resource.URL.String()) && !resource.resumed {
 		return
 	}
 
@@ -370,7 +1024,14 @@ func (c *Crawler) enqueue(resource *Resource) {
 		return
 	}
 
-	if !worker.agent.Test(resource.URL.Path) {
+	// the seed is crawled regardless of the patterns,
+	// so that the pages they match can be found
+	if resource != worker.Tree && !worker.filter.allows(resource.URL) {
+		return
+	}
+
+	// the robots.txt of the other hosts is checked by fetch
+	if resource.URL.Host == worker.seed.Host && !c.permits(worker, resource.URL) {
 		log.Printf("[ERROR] robots.txt policy does not allow path to be crawled: %v\n", resource.URL.String())
 		return
 	}
@@ -380,39 +1041,102 @@ func (c *Crawler) enqueue(resource *Resource) {
 		return
 	}
 
+	req = req.WithContext(worker.ctx)
+
 	req.Header.Add("User-Agent", c.UserAgent)
-	worker.Add(1)
+	if !worker.acquire() {
+		return
+	}
 
 	// fetch resource
+	dispatched = true
 	go func(req *http.Request, resource *Resource) { c.fetch(req, resource) }(req, resource)
 }
 
-// isMIMETypeHTML makes an attempt to determine if the resource
-// has a mime-type ~ text/html. when crawling web resources, not
-// always you will encounter html mime-type content, but also other
+// describe records the response's metadata on the resource
+func (r *Resource) describe(resp *http.Response) {
+	r.HTTPStatusCode = resp.StatusCode
+	r.ContentType = resp.Header.Get("Content-Type")
+	r.ContentLength = 0
+	if resp.ContentLength > 0 {
+		r.ContentLength = resp.ContentLength
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		r.Kind = KindError
+		r.Error = resp.Status
+	}
+
+	if resp.StatusCode >= http.StatusMultipleChoices && resp.StatusCode < http.StatusBadRequest {
+		r.Kind = KindRedirect
+	}
+}
+
+// isHTML reports if the resource's content type is ~ text/html
+func (r *Resource) isHTML() bool {
+	t, _, err := mime.ParseMediaType(r.ContentType)
+	return err == nil && t == "text/html"
+}
+
+// sniff makes an attempt to determine if the resource has a
+// mime-type ~ text/html. when crawling web resources, not always
+// you will encounter html mime-type content, but also other
 // mime-types such as js, json, jpg, css, svg, mp{3,4} etc, which
-// are not html documents and therefore these resouces cannot contain
-// child resources defined by html tags such as <a href=... />
-func (c *Crawler) isMIMETypeHTML(resource *Resource) (bool, error) {
-	texthtml := "text/html"
-	req, err := http.NewRequest(http.MethodHead, resource.URL.String(), nil)
-	if err != nil {
-		return false, err
+// are not html documents and therefore these resouces cannot
+// contain child resources defined by html tags such as <a href />.
+// the Content-Type is trusted, unless it is missing or generic, in
+// which case it is detected from the first bytes of the body; the
+// returned reader yields the body from the start
+func (r *Resource) sniff(body io.Reader) (io.Reader, bool) {
+	if t, _, _ := mime.ParseMediaType(r.ContentType); t != "" && t != "application/octet-stream" {
+		return body, r.isHTML()
 	}
 
-	req.Header.Add("User-Agent", c.UserAgent)
-	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return false, err
+	buffered := bufio.NewReaderSize(body, sniffLen)
+	head, _ := buffered.Peek(sniffLen)
+	if r.ContentType == "" {
+		r.ContentType = http.DetectContentType(head)
+		return buffered, r.isHTML()
 	}
 
-	defer resp.Body.Close()
-	t, _, err := mime.ParseMediaType(resp.Header.Get("Content-type"))
-	if err != nil {
-		return false, err
+	t, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	return buffered, t == "text/html"
+}
+
+// duplicate records the <link rel=canonical> of a page, when it is
+// honoured and names another URL in scope; the page stands in for
+// that URL, which is marked visited, and the page is a duplicate
+// when the URL was visited already
+func (c *Crawler) duplicate(resource *Resource, page *PageInfo, base *url.URL) bool {
+	if page.Canonical == "" || c.Canonicalizer == nil || !c.Canonicalizer.HonourCanonical {
+		return false
+	}
+
+	absolute := normaliseURL(page.Canonical, base)
+	if absolute == nil {
+		return false
+	}
+
+	canonical := c.Canonicalizer.Canonical(absolute)
+	if canonical.String() == resource.URLString || !resource.worker.scope.allows(canonical) {
+		return false
+	}
+
+	resource.Canonical = canonical.String()
+	return resource.worker.visited(resource.Canonical)
+}
+
+// fail records a failed fetch in the tree, unless it failed
+// because the crawl was stopped, in which case the resource
+// is left on the frontier to be fetched if the crawl resumes
+func (c *Crawler) fail(resource *Resource, err error) {
+	if resource.worker.ctx.Err() != nil {
+		return
 	}
 
-	return (t == texthtml), nil
+	resource.Kind = KindError
+	resource.Error = err.Error()
+	c.append(resource)
 }
 
 // fetch makes a HTTPRequest using the provided HTTPRequest
@@ -422,62 +1146,153 @@ func (c *Crawler) isMIMETypeHTML(resource *Resource) (bool, error) {
 // into an infinite loop with websites which cross-reference
 // large media content sites such as youtube.com / reddit.com
 func (c *Crawler) fetch(req *http.Request, resource *Resource) {
-	worker, _ := c.workers[resource.Root.String()]
-	defer worker.Done()
-	defer func() { <-c.throttle }()
-	c.throttle <- true
+	worker := resource.worker
+	defer worker.wg.Done()
+	defer worker.pop(resource)
+
+	if resource.URL.Host != worker.seed.Host && !c.permits(worker, resource.URL) {
+		log.Printf("[ERROR] robots.txt policy does not allow path to be crawled: %v\n", resource.URL.String())
+		return
+	}
+
+	// honour the host's concurrency & crawl delay
+	// before taking a throttle slot, so that a slow
+	// host does not hold up the slots of the others
+	if err := worker.limiter.acquire(worker.ctx); err != nil {
+		return
+	}
 
-	// if queue is closed
-	// dont start new work
-	if c.q.closed {
+	defer worker.limiter.release()
+	if err := worker.limiter.wait(worker.ctx); err != nil {
 		return
 	}
 
-	isHTML, err := c.isMIMETypeHTML(resource)
-	if err != nil || !isHTML {
+	defer func() { <-c.throttle }()
+	c.throttle <- true
+
+	// if queue is closed or the crawl
+	// is cancelled dont start new work
+	if c.q.isClosed() || worker.ctx.Err() != nil {
 		return
 	}
 
-	if worker.status != StatusFetchingInProgress {
-		worker.status = StatusFetchingInProgress
+	if worker.begin() {
+		worker.save()
 	}
 
-	resp, err := c.HTTPClient.Do(req)
+	resp, err := c.send(resource, req)
 	if err != nil {
+		c.fail(resource, err)
 		return
 	}
 
+	// the body is closed without being read, unless it is
+	// a page or it is archived, and it is never read past
+	// the crawler's max body size
+	limitBody(resp, c.MaxBodySize)
+	worker.archive.wrap(resp)
 	defer resp.Body.Close()
+	resource.describe(resp)
+	if resource.Kind == KindError || resource.Kind == KindRedirect {
+		c.append(resource)
+		return
+	}
 
-	// add node to the leaf
-	resource.HTTPStatusCode = resp.StatusCode
-	resource.Title, _ = getTitleForPage(resp.Body)
-	go func(resource *Resource) { c.append(resource) }(resource)
-
-	links := collectlinks.All(resp.Body)
+	resource.NoIndex, resource.NoFollow = robotsTag(resp.Header, agentToken(c.UserAgent))
+
+	// the links of a redirected page resolve against the URL it
+	// was redirected to, which is not fetched again; unless it was
+	// visited already, and is crawled on its own
+	final := resp.Request.URL
+	if len(resource.Redirects) > 0 {
+		resource.FinalURL = final.String()
+		canonical := c.Canonicalizer.Canonical(final).String()
+		if canonical != resource.URLString && worker.visited(canonical) {
+			resource.Kind = KindRedirect
+			c.append(resource)
+			return
+		}
+	}
 
-	if len(links) == 0 {
+	// the links of assets are not followed, so they are recorded as is
+	body, isHTML := resource.sniff(resp.Body)
+	if !isHTML {
+		resource.Kind = KindAsset
+		c.append(resource)
 		return
 	}
 
-	for _, link := range links {
-		absolute := normaliseURL(link, resource.URL)
-		if absolute != nil {
-			go func(absolute *url.URL, resource *Resource) {
-				if c.q.closed {
-					return
-				}
+	// parse the page once, the tree builder
+	// and the link enqueuer both consume it
+	page, err := ParsePage(body)
+	if err != nil {
+		log.Printf("[ERROR] failed to parse page: %v, error: %v\n", resource.URL.String(), err)
+	}
 
-				c.q.ch <- &Resource{
-					URL:         absolute,
-					Root:        resource.Root,
-					URLString:   absolute.String(),
-					Nodes:       make([]*Resource, 0),
-					Parent:      append(resource.Parent, resource.URL.String()),
-					Depth:       resource.Depth + 1,
-					LastFetched: time.Now(),
-				}
-			}(absolute, resource)
+	resource.Kind = KindPage
+	resource.NoIndex = resource.NoIndex || page.NoIndex
+	resource.NoFollow = resource.NoFollow || page.NoFollow
+	if !resource.NoIndex || worker.opts.Audit {
+		resource.Title = page.Title
+		resource.SimHash = SimHash(page.Text)
+	}
+
+	// the links of a duplicate page are recorded, but they
+	// are not followed, the page it duplicates is crawled
+	base := page.Base(final)
+	duplicate := c.duplicate(resource, page, base) || worker.nearDuplicate(resource)
+
+	// copy the ancestry, so that the siblings
+	// do not share the parent's backing array
+	parent := make([]string, len(resource.Parent), len(resource.Parent)+1)
+	copy(parent, resource.Parent)
+	parent = append(parent, resource.URL.String())
+
+	// resolve the links, they are recorded along with the page,
+	// but nofollow links are not followed unless auditing
+	follow := !duplicate && (!resource.NoFollow || worker.opts.Audit)
+	children := make([]*Resource, 0, len(page.Links))
+	for i, link := range page.Links {
+		absolute := normaliseURL(link.Href, base)
+		if absolute == nil {
+			continue
 		}
+
+		canonical := c.Canonicalizer.Canonical(absolute)
+		if !worker.scope.allows(canonical) {
+			continue
+		}
+
+		resource.links = append(resource.links, Edge{
+			Source:   resource.URLString,
+			Target:   canonical.String(),
+			Text:     link.Text,
+			Rel:      link.Rel,
+			Position: i,
+		})
+
+		if !follow || (link.NoFollow && !worker.opts.Audit) {
+			continue
+		}
+
+		children = append(children, &Resource{
+			URL:         canonical,
+			URLString:   canonical.String(),
+			RawURL:      absolute.String(),
+			Root:        resource.Root,
+			Nodes:       make([]*Resource, 0),
+			Parent:      parent,
+			Depth:       resource.Depth + 1,
+			LastFetched: time.Now(),
+			worker:      worker,
+		})
+	}
+
+	// add node to the leaf
+	c.append(resource)
+
+	for _, child := range children {
+		worker.push(child)
+		go c.schedule(child)
 	}
 }
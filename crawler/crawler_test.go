@@ -1,10 +1,14 @@
 package crawler
 
 // module deps
-import "strings"
+import "sync"
+import "time"
+import "context"
 import "testing"
 import "net/url"
-import "io/ioutil"
+import "net/http"
+import "net/http/httptest"
+import "github.com/temoto/robotstxt-go"
 
 // test NormaliseURL
 func TestNormaliseURL(t *testing.T) {
@@ -21,28 +25,449 @@ func TestNormaliseURL(t *testing.T) {
 	}
 }
 
-// test GetTitleForPage
-func TestGetTitleForPage(t *testing.T) {
+// test NewCrawler
+func TestNewCrawler(t *testing.T) {
 	// execute test in parallel
 	t.Parallel()
 
-	doc := ioutil.NopCloser(strings.NewReader(`<meta charset="UTF-8"><title>Example Title</title>`))
-	title, err := getTitleForPage(doc)
+	c := New()
+	defer c.Close()
 
-	if err != nil || title != "Example Title" {
-		t.Fatalf("expected Example Title, got: %v\n", title)
+	if c == nil {
+		t.Fatalf("expected new crawler, got nil\n")
 	}
 }
 
-// test NewCrawler
-func TestNewCrawler(t *testing.T) {
+// test crawl delay is bounded by the floor & ceiling
+func TestCrawlDelay(t *testing.T) {
 	// execute test in parallel
 	t.Parallel()
 
 	c := New()
 	defer c.Close()
+	c.MinCrawlDelay = time.Second
+	c.MaxCrawlDelay = 10 * time.Second
 
-	if c == nil {
-		t.Fatalf("expected new crawler, got nil\n")
+	tests := []struct {
+		robots   time.Duration
+		override time.Duration
+		expected time.Duration
+	}{
+		{0, 0, time.Second},
+		{5 * time.Second, 0, 5 * time.Second},
+		{time.Minute, 0, 10 * time.Second},
+		{5 * time.Second, 2 * time.Second, 2 * time.Second},
+		{5 * time.Second, time.Millisecond, time.Second},
+	}
+
+	for _, test := range tests {
+		agent := &robotstxt.Group{CrawlDelay: test.robots}
+		if delay := c.crawlDelay(agent, test.override); delay != test.expected {
+			t.Fatalf("expected %v, got: %v\n", test.expected, delay)
+		}
+	}
+}
+
+// test limiter spaces out requests
+func TestLimiter(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	delay := 20 * time.Millisecond
+	l := newLimiter(delay)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		l.wait(context.Background())
+	}
+
+	if elapsed := time.Since(start); elapsed < 2*delay {
+		t.Fatalf("expected at least %v, got: %v\n", 2*delay, elapsed)
+	}
+}
+
+// test adaptive limiter backs off on errors & speeds up when healthy
+func TestAdaptiveLimiter(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	l := newAdaptiveLimiter(0, time.Second, 2)
+	if p := l.state(); p.Mode != PolitenessAdaptive || p.Delay != 0 || p.Concurrency != 1 {
+		t.Fatalf("expected adaptive at no delay & 1 in flight, got: %+v\n", p)
+	}
+
+	// errors double the delay, up to the ceiling
+	for i := 0; i < 4; i++ {
+		l.observe(10*time.Millisecond, http.StatusServiceUnavailable, nil)
+	}
+
+	if p := l.state(); p.Delay != time.Second || p.ErrorRate == 0 {
+		t.Fatalf("expected the ceiling & an error rate, got: %+v\n", p)
+	}
+
+	// healthy responses speed up, down to the floor and up to max concurrency
+	for i := 0; i < 100; i++ {
+		l.observe(10*time.Millisecond, http.StatusOK, nil)
+	}
+
+	if p := l.state(); p.Delay != 0 || p.Concurrency != 2 || p.Latency == 0 {
+		t.Fatalf("expected no delay & 2 in flight, got: %+v\n", p)
+	}
+
+	// rising latency slows down
+	l.observe(time.Second, http.StatusOK, nil)
+	if p := l.state(); p.Delay != AdaptiveDelayStep || p.Concurrency != 1 {
+		t.Fatalf("expected to slow down, got: %+v\n", p)
+	}
+
+	// a slot is released to the next caller
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	l.acquire(ctx)
+	if err := l.acquire(ctx); err == nil {
+		t.Fatalf("expected the second slot to be refused\n")
+	}
+
+	l.release()
+	if err := l.acquire(context.Background()); err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+}
+
+// newTestSite serves the given pages as text/html, and
+// responds with 404 to every other path but robots.txt
+func newTestSite(pages map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: *\nAllow: /\n"))
+			return
+		}
+
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(page))
+	}))
+}
+
+// test Cancel stops a crawl and unregisters the domain
+func TestCancel(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	// a page that never responds
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: *\nAllow: /\n"))
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	c := New()
+	defer c.Close()
+
+	if err := c.Crawl(server.URL, 1); err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	if err := c.Cancel(server.URL); err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	if c.Worker(server.URL) != nil {
+		t.Fatalf("expected worker to be removed\n")
+	}
+
+	if err := c.Cancel(server.URL); err != ErrDomainNotRegistered {
+		t.Fatalf("expected %v, got: %v\n", ErrDomainNotRegistered, err)
+	}
+
+	if err := c.Crawl(server.URL, 1); err != nil {
+		t.Fatalf("expected domain to be crawled again, got: %v\n", err)
+	}
+}
+
+// test the registry is not locked while robots.txt is looked up
+func TestCrawlDoesNotLockRegistry(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	// a robots.txt that does not respond until released
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer slow.Close()
+
+	server := newTestSite(map[string]string{"/": `<title>Home</title>`})
+	defer server.Close()
+
+	c := New()
+	defer c.Close()
+
+	started := make(chan error)
+	go func() { started <- c.Crawl(slow.URL, 1) }()
+
+	done := make(chan struct{})
+	go func() {
+		c.Worker(slow.URL)
+		c.Crawl(server.URL, 1)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the registry not to wait for robots.txt\n")
+	}
+
+	close(release)
+	if err := <-started; err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	if err := c.Crawl(slow.URL, 1); err != ErrDomainAlreadyRegistered {
+		t.Fatalf("expected %v, got: %v\n", ErrDomainAlreadyRegistered, err)
+	}
+}
+
+// test Recrawl retains the previous run as a snapshot
+func TestRecrawl(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	server := newTestSite(map[string]string{"/": `<title>Home</title>`})
+	defer server.Close()
+
+	c := New()
+	defer c.Close()
+
+	if err := c.Recrawl(server.URL); err != ErrDomainNotRegistered {
+		t.Fatalf("expected %v, got: %v\n", ErrDomainNotRegistered, err)
+	}
+
+	if err := c.Crawl(server.URL, 1); err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	first := c.Worker(server.URL).Tree
+	if err := c.Recrawl(server.URL); err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	worker := c.Worker(server.URL)
+	if worker.Run() != 2 || len(worker.Snapshots()) != 1 {
+		t.Fatalf("expected run 2 with 1 snapshot, got: %d, %d\n", worker.Run(), len(worker.Snapshots()))
+	}
+
+	if snapshot := worker.Snapshot(1); snapshot == nil || snapshot.Tree != first {
+		t.Fatalf("expected snapshot 1 to retain the previous tree, got: %v\n", snapshot)
+	}
+
+	if snapshot := worker.Snapshot(2); snapshot == nil || snapshot.Tree != worker.Tree {
+		t.Fatalf("expected snapshot 2 to be the current run, got: %v\n", snapshot)
+	}
+}
+
+// test a crawl completes as soon as the frontier is empty
+func TestCrawlCompletes(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	server := newTestSite(map[string]string{
+		"/":  `<a href="/a">A</a><title>Home</title><a href="/b">B</a>`,
+		"/a": `<title>A</title><a href="/c">C</a><a href="/">Home</a>`,
+		"/b": `<title>B</title>`,
+		"/c": `<title>C</title>`,
+	})
+	defer server.Close()
+
+	c := New()
+	defer c.Close()
+
+	if err := c.Crawl(server.URL+"/", 3); err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	worker := c.Worker(server.URL + "/")
+	select {
+	case <-worker.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected crawl to complete, pending: %d\n", worker.Pending())
+	}
+
+	if worker.Status() != StatusFetchingComplete || worker.Pending() != 0 {
+		t.Fatalf("expected complete, got: %v, pending: %d\n", worker.Status(), worker.Pending())
+	}
+
+	count := 0
+	var walk func(node *Resource)
+	walk = func(node *Resource) {
+		count++
+		for _, child := range node.Nodes {
+			walk(child)
+		}
+	}
+
+	walk(worker.Tree)
+	if count != 4 || worker.Tree.Title != "Home" {
+		t.Fatalf("expected 4 pages under Home, got: %d under %v\n", count, worker.Tree.Title)
+	}
+}
+
+// test assets & broken links are recorded, but not followed
+func TestCrawlRecordsAssetsAndErrors(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nAllow: /\n"))
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<title>Home</title><a href="/doc.pdf">Doc</a><a href="/missing">Gone</a>`))
+		case "/doc.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Write([]byte(`<a href="/hidden">Hidden</a>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	c := New()
+	defer c.Close()
+
+	if err := c.Crawl(server.URL+"/", 3); err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	worker := c.Worker(server.URL + "/")
+	<-worker.Done()
+
+	nodes := make(map[string]*Resource)
+	for _, node := range worker.Tree.Nodes {
+		nodes[node.URL.Path] = node
+	}
+
+	if worker.Tree.Kind != KindPage || len(nodes) != 2 {
+		t.Fatalf("expected a page with 2 nodes, got: %v, %v\n", worker.Tree.Kind, worker.Tree.Nodes)
+	}
+
+	if doc := nodes["/doc.pdf"]; doc == nil || doc.Kind != KindAsset || doc.ContentType != "application/pdf" || len(doc.Nodes) != 0 {
+		t.Fatalf("expected an asset without nodes, got: %v\n", doc)
+	}
+
+	if missing := nodes["/missing"]; missing == nil || missing.Kind != KindError || missing.HTTPStatusCode != http.StatusNotFound || missing.Error == "" {
+		t.Fatalf("expected a 404 error, got: %v\n", missing)
+	}
+}
+
+// test every resource is fetched with a single GET, and its
+// content type is sniffed when the header is generic
+func TestCrawlSniffsContentType(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nAllow: /\n"))
+		case "/":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte(`<!DOCTYPE html><title>Home</title><a href="/big">Big</a>`))
+		case "/big":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(make([]byte, 1<<20))
+		}
+	}))
+	defer server.Close()
+
+	c := New()
+	defer c.Close()
+	c.MaxBodySize = 1024
+
+	if err := c.Crawl(server.URL+"/", 3); err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	worker := c.Worker(server.URL + "/")
+	<-worker.Done()
+
+	if worker.Tree.Kind != KindPage || worker.Tree.Title != "Home" || len(worker.Tree.Nodes) != 1 {
+		t.Fatalf("expected a page with 1 node, got: %v, %v\n", worker.Tree.Kind, worker.Tree.Nodes)
+	}
+
+	if big := worker.Tree.Nodes[0]; big.Kind != KindAsset {
+		t.Fatalf("expected an asset, got: %v\n", big.Kind)
+	}
+
+	if requests["/"] != 1 || requests["/big"] != 1 {
+		t.Fatalf("expected a request per resource, got: %v\n", requests)
+	}
+}
+
+// test CrawlContext cancels the crawl along with its context
+func TestCrawlContext(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	// a page that never responds
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: *\nAllow: /\n"))
+			return
+		}
+
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	c := New()
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := c.CrawlContext(ctx, server.URL, Options{Depth: 1}); err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	cancel()
+	worker := c.Worker(server.URL)
+	select {
+	case <-worker.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected crawl to stop, pending: %d\n", worker.Pending())
+	}
+
+	if worker.Status() != StatusCancelled || len(worker.Tree.Nodes) != 0 || worker.Tree.Kind != "" {
+		t.Fatalf("expected a cancelled crawl without a failed seed, got: %v, %v\n", worker.Status(), worker.Tree.Kind)
 	}
 }
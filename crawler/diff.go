@@ -0,0 +1,129 @@
+package crawler
+
+// module deps
+import "sort"
+
+// Change describes a page attribute that differs between two trees
+type Change struct {
+	// page URL
+	URL string `json:"url"`
+
+	// value in the older tree
+	From string `json:"from"`
+
+	// value in the newer tree
+	To string `json:"to"`
+}
+
+// StatusChange describes a page whose HTTP StatusCode differs
+type StatusChange struct {
+	// page URL
+	URL string `json:"url"`
+
+	// status in the older tree
+	From int `json:"from"`
+
+	// status in the newer tree
+	To int `json:"to"`
+}
+
+// DiffReport describes the differences between two trees
+type DiffReport struct {
+	// pages only in the newer tree
+	Added []string `json:"added"`
+
+	// pages only in the older tree
+	Removed []string `json:"removed"`
+
+	// pages whose status code changed
+	StatusChanged []StatusChange `json:"status_changed"`
+
+	// pages whose title changed
+	TitleChanged []Change `json:"title_changed"`
+
+	// pages found under a different parent
+	Moved []Change `json:"moved"`
+}
+
+// flatNode is a flattened tree node
+type flatNode struct {
+	status int
+	title  string
+	parent string
+}
+
+// flatten indexes the tree by URL along with each node's parent
+func flatten(root *Resource) map[string]flatNode {
+	pages := make(map[string]flatNode)
+	if root == nil {
+		return pages
+	}
+
+	// the tree is only ever mutated under the root's lock
+	root.Lock()
+	defer root.Unlock()
+
+	var walk func(node *Resource, parent string)
+	walk = func(node *Resource, parent string) {
+		pages[node.URLString] = flatNode{status: node.HTTPStatusCode, title: node.Title, parent: parent}
+		for _, child := range node.Nodes {
+			walk(child, node.URLString)
+		}
+	}
+
+	walk(root, "")
+	return pages
+}
+
+// Diff compares the older tree a with the newer tree b and reports
+// pages added, removed, with a changed status code, changed title
+// or moved to a different parent; the lists are sorted by URL
+func Diff(a, b *Resource) *DiffReport {
+	report := &DiffReport{
+		Added:         make([]string, 0),
+		Removed:       make([]string, 0),
+		StatusChanged: make([]StatusChange, 0),
+		TitleChanged:  make([]Change, 0),
+		Moved:         make([]Change, 0),
+	}
+
+	if a == b {
+		return report
+	}
+
+	older := flatten(a)
+	newer := flatten(b)
+
+	for uri, was := range older {
+		is, exists := newer[uri]
+		if !exists {
+			report.Removed = append(report.Removed, uri)
+			continue
+		}
+
+		if was.status != is.status {
+			report.StatusChanged = append(report.StatusChanged, StatusChange{URL: uri, From: was.status, To: is.status})
+		}
+
+		if was.title != is.title {
+			report.TitleChanged = append(report.TitleChanged, Change{URL: uri, From: was.title, To: is.title})
+		}
+
+		if was.parent != is.parent {
+			report.Moved = append(report.Moved, Change{URL: uri, From: was.parent, To: is.parent})
+		}
+	}
+
+	for uri := range newer {
+		if _, exists := older[uri]; !exists {
+			report.Added = append(report.Added, uri)
+		}
+	}
+
+	sort.Strings(report.Added)
+	sort.Strings(report.Removed)
+	sort.Slice(report.StatusChanged, func(i, j int) bool { return report.StatusChanged[i].URL < report.StatusChanged[j].URL })
+	sort.Slice(report.TitleChanged, func(i, j int) bool { return report.TitleChanged[i].URL < report.TitleChanged[j].URL })
+	sort.Slice(report.Moved, func(i, j int) bool { return report.Moved[i].URL < report.Moved[j].URL })
+	return report
+}
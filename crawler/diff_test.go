@@ -0,0 +1,49 @@
+package crawler
+
+// module deps
+import "testing"
+
+// node builds a tree node for tests
+func node(uri string, status int, title string, nodes ...*Resource) *Resource {
+	return &Resource{URLString: uri, HTTPStatusCode: status, Title: title, Nodes: nodes}
+}
+
+// test Diff reports every kind of change
+func TestDiff(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	a := node("/", 200, "Home",
+		node("/a", 200, "A", node("/c", 200, "C")),
+		node("/b", 200, "B"),
+		node("/removed", 200, "Removed"),
+	)
+
+	b := node("/", 200, "Home",
+		node("/a", 500, "A"),
+		node("/b", 200, "B2", node("/c", 200, "C")),
+		node("/added", 200, "Added"),
+	)
+
+	report := Diff(a, b)
+
+	if len(report.Added) != 1 || report.Added[0] != "/added" {
+		t.Fatalf("expected /added, got: %v\n", report.Added)
+	}
+
+	if len(report.Removed) != 1 || report.Removed[0] != "/removed" {
+		t.Fatalf("expected /removed, got: %v\n", report.Removed)
+	}
+
+	if len(report.StatusChanged) != 1 || report.StatusChanged[0] != (StatusChange{URL: "/a", From: 200, To: 500}) {
+		t.Fatalf("expected /a 200 -> 500, got: %v\n", report.StatusChanged)
+	}
+
+	if len(report.TitleChanged) != 1 || report.TitleChanged[0] != (Change{URL: "/b", From: "B", To: "B2"}) {
+		t.Fatalf("expected /b B -> B2, got: %v\n", report.TitleChanged)
+	}
+
+	if len(report.Moved) != 1 || report.Moved[0] != (Change{URL: "/c", From: "/a", To: "/b"}) {
+		t.Fatalf("expected /c /a -> /b, got: %v\n", report.Moved)
+	}
+}
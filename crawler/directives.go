@@ -0,0 +1,71 @@
+package crawler
+
+// module deps
+import "strings"
+import "net/http"
+
+// robotsDirectives parses the comma separated directives of a meta
+// robots tag, or of a X-Robots-Tag header; none is noindex, nofollow
+// @see https://developers.google.com/search/docs/crawling-indexing/robots-meta-tag
+func robotsDirectives(content string) (noindex, nofollow bool) {
+	for _, directive := range strings.Split(content, ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "noindex":
+			noindex = true
+		case "nofollow":
+			nofollow = true
+		case "none":
+			noindex, nofollow = true, true
+		}
+	}
+
+	return noindex, nofollow
+}
+
+// robotsTag parses the X-Robots-Tag headers of a response; a header
+// prefixed by a user agent, such as googlebot: noindex, only applies
+// to that agent, other headers apply to every agent
+func robotsTag(header http.Header, agent string) (noindex, nofollow bool) {
+	for _, value := range header.Values("X-Robots-Tag") {
+		if i := strings.Index(value, ":"); i >= 0 && isAgent(value[:i]) {
+			if !strings.EqualFold(strings.TrimSpace(value[:i]), agent) {
+				continue
+			}
+
+			value = value[i+1:]
+		}
+
+		index, follow := robotsDirectives(value)
+		noindex, nofollow = noindex || index, nofollow || follow
+	}
+
+	return noindex, nofollow
+}
+
+// isAgent reports if the prefix of a X-Robots-Tag header is a user
+// agent, rather than a directive with a value such as max-snippet
+func isAgent(prefix string) bool {
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	if prefix == "" || strings.ContainsAny(prefix, ", ") {
+		return false
+	}
+
+	switch prefix {
+	case "unavailable_after", "max-snippet", "max-image-preview", "max-video-preview":
+		return false
+	}
+
+	return true
+}
+
+// agentToken returns the product token of a user agent string, as
+// it is named by user agent specific directives; e.g. GoCrawler of
+// GoCrawler/v0.1 (+https://github.com/q/gocrawler)
+func agentToken(userAgent string) string {
+	token := strings.TrimSpace(userAgent)
+	if i := strings.IndexAny(token, "/ "); i >= 0 {
+		token = token[:i]
+	}
+
+	return token
+}
@@ -0,0 +1,95 @@
+package crawler
+
+// module deps
+import "testing"
+import "net/http"
+import "net/http/httptest"
+
+// test robotsTag applies the headers for every agent, and for the crawler's
+func TestRobotsTag(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	cases := []struct {
+		values   []string
+		noindex  bool
+		nofollow bool
+	}{
+		{[]string{"noindex"}, true, false},
+		{[]string{"none"}, true, true},
+		{[]string{"googlebot: nofollow"}, false, false},
+		{[]string{"GoCrawler: nofollow", "noarchive"}, false, true},
+		{[]string{"unavailable_after: 25 Jun 2010 15:00:00 PST, noindex"}, true, false},
+		{[]string{"max-snippet: 20"}, false, false},
+	}
+
+	for _, tc := range cases {
+		header := http.Header{}
+		for _, value := range tc.values {
+			header.Add("X-Robots-Tag", value)
+		}
+
+		noindex, nofollow := robotsTag(header, agentToken(DefaultUserAgent))
+		if noindex != tc.noindex || nofollow != tc.nofollow {
+			t.Fatalf("expected %v, %v for %v, got: %v, %v\n", tc.noindex, tc.nofollow, tc.values, noindex, nofollow)
+		}
+	}
+}
+
+// test a crawl honours nofollow & noindex, unless it is an audit
+func TestCrawlDirectives(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	site := newTestSite(map[string]string{
+		"/":       `<title>Home</title><a href="/a">A</a><a href="/b" rel="nofollow">B</a><a href="/hidden">Hidden</a>`,
+		"/a":      `<title>A</title><meta name="robots" content="noindex,nofollow"><a href="/c">C</a>`,
+		"/b":      `<title>B</title>`,
+		"/c":      `<title>C</title>`,
+		"/hidden": `<title>Hidden</title><a href="/d">D</a>`,
+		"/d":      `<title>D</title>`,
+	})
+	site.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/hidden" {
+			w.Header().Set("X-Robots-Tag", "nofollow")
+		}
+
+		site.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	for _, audit := range []bool{false, true} {
+		c := New()
+		defer c.Close()
+
+		if err := c.CrawlWithOptions(server.URL+"/", Options{Depth: 3, Audit: audit}); err != nil {
+			t.Fatalf("expected nil error, got: %v\n", err)
+		}
+
+		worker := c.Worker(server.URL + "/")
+		<-worker.Done()
+
+		nodes := make(map[string]*Resource)
+		for _, node := range worker.Tree.Nodes {
+			nodes[node.URLString] = node
+			for _, child := range node.Nodes {
+				nodes[child.URLString] = child
+			}
+		}
+
+		a, hidden := nodes[server.URL+"/a"], nodes[server.URL+"/hidden"]
+		if a == nil || !a.NoIndex || !a.NoFollow || hidden == nil || hidden.NoIndex || !hidden.NoFollow {
+			t.Fatalf("expected the directives to be flagged, got: %v, %v\n", a, hidden)
+		}
+
+		if audit && (len(nodes) != 5 || a.Title != "A") {
+			t.Fatalf("expected an audit to follow every link, got: %v\n", nodes)
+		}
+
+		if !audit && (len(nodes) != 2 || a.Title != "" || a.SimHash != 0) {
+			t.Fatalf("expected /a & /hidden only, without the content of /a, got: %v\n", nodes)
+		}
+	}
+}
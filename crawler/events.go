@@ -0,0 +1,115 @@
+package crawler
+
+// constants
+const (
+	// events buffered per subscriber; a subscriber that
+	// falls further behind is dropped, rather than hold
+	// up the fetches of the worker
+	EventBufferSize = 256
+)
+
+// Event describes a resource, as soon as it is fetched
+type Event struct {
+	// resource URL
+	URL string `json:"url"`
+
+	// HTTP StatusCode
+	HTTPStatusCode int `json:"status"`
+
+	// page, asset, redirect or error
+	Kind ResourceKind `json:"kind,omitempty"`
+
+	// transport error or HTTP status of a failed fetch
+	Error string `json:"error,omitempty"`
+
+	// from meta
+	Title string `json:"title"`
+
+	// current depth
+	Depth int `json:"depth"`
+
+	// URL of the page it was found on, empty for the seed
+	Parent string `json:"parent,omitempty"`
+}
+
+// event returns the event of a fetched resource
+func (r *Resource) event() *Event {
+	e := &Event{
+		URL:            r.URLString,
+		HTTPStatusCode: r.HTTPStatusCode,
+		Kind:           r.Kind,
+		Error:          r.Error,
+		Title:          r.Title,
+		Depth:          r.Depth,
+	}
+
+	if len(r.Parent) > 0 {
+		e.Parent = r.Parent[len(r.Parent)-1]
+	}
+
+	return e
+}
+
+// Subscription delivers the events of a worker's crawl
+type Subscription struct {
+	// resources fetched before the subscription, in order
+	History []*Event
+
+	// resources fetched since; it is closed when the
+	// subscription is closed or the subscriber is dropped
+	C <-chan *Event
+
+	// owning worker & send side of C
+	worker *Worker
+	ch     chan *Event
+}
+
+// Close ends the subscription
+func (s *Subscription) Close() {
+	s.worker.mu.Lock()
+	defer s.worker.mu.Unlock()
+
+	s.worker.unsubscribe(s.ch)
+}
+
+// Subscribe returns a subscription to the resources of the
+// current run; an event is either in the history or in C
+func (w *Worker) Subscribe() *Subscription {
+	ch := make(chan *Event, EventBufferSize)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.subscribers[ch] = struct{}{}
+	s := &Subscription{History: make([]*Event, 0, len(w.fetched)), C: ch, worker: w, ch: ch}
+	for _, resource := range w.fetched {
+		s.History = append(s.History, resource.event())
+	}
+
+	return s
+}
+
+// unsubscribe removes & closes the channel of a subscriber;
+// the caller holds the mutex
+func (w *Worker) unsubscribe(ch chan *Event) {
+	if _, ok := w.subscribers[ch]; ok {
+		delete(w.subscribers, ch)
+		close(ch)
+	}
+}
+
+// publish records a fetched resource, and sends its
+// event to the subscribers
+func (w *Worker) publish(resource *Resource) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.fetched = append(w.fetched, resource)
+	e := resource.event()
+	for ch := range w.subscribers {
+		select {
+		case ch <- e:
+		default:
+			w.unsubscribe(ch)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package crawler
+
+// module deps
+import "io"
+import "fmt"
+import "bufio"
+import "errors"
+import "strconv"
+import "strings"
+import "encoding/csv"
+import "encoding/xml"
+import "encoding/json"
+
+// export formats
+const (
+	ExportGraphML = "graphml"
+	ExportDOT     = "dot"
+	ExportCSV     = "csv"
+	ExportJSONL   = "jsonl"
+)
+
+// ErrUnsupportedFormat is used when the export format is unknown
+var ErrUnsupportedFormat = errors.New("unsupported export format")
+
+// Export writes the link graph of the current run in the format;
+// the document is written node by node & edge by edge, rather than
+// built in memory first. csv is the edge list, along with the
+// status & kind of every target
+func (w *Worker) Export(out io.Writer, format string) error {
+	buf := bufio.NewWriter(out)
+
+	var err error
+	switch format {
+	case ExportGraphML:
+		err = exportGraphML(buf, w.seed.String(), w.Graph)
+	case ExportDOT:
+		err = exportDOT(buf, w.seed.String(), w.Graph)
+	case ExportCSV:
+		err = exportCSV(buf, w.Graph)
+	case ExportJSONL:
+		err = exportJSONL(buf, w.Graph)
+	default:
+		return ErrUnsupportedFormat
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return buf.Flush()
+}
+
+// xmlEscape returns s escaped for use in XML text & attributes
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// exportGraphML writes the graph as GraphML
+// @see http://graphml.graphdrawing.org/
+func exportGraphML(out *bufio.Writer, name string, g *Graph) error {
+	fmt.Fprint(out, xml.Header)
+	fmt.Fprintln(out, `<graphml xmlns="http://graphml.graphdrawing.org/xmlns">`)
+	fmt.Fprintln(out, `  <key id="title" for="node" attr.name="title" attr.type="string"/>`)
+	fmt.Fprintln(out, `  <key id="status" for="node" attr.name="status" attr.type="int"/>`)
+	fmt.Fprintln(out, `  <key id="kind" for="node" attr.name="kind" attr.type="string"/>`)
+	fmt.Fprintln(out, `  <key id="in_links" for="node" attr.name="in_links" attr.type="int"/>`)
+	fmt.Fprintln(out, `  <key id="text" for="edge" attr.name="text" attr.type="string"/>`)
+	fmt.Fprintln(out, `  <key id="rel" for="edge" attr.name="rel" attr.type="string"/>`)
+	fmt.Fprintln(out, `  <key id="position" for="edge" attr.name="position" attr.type="int"/>`)
+	fmt.Fprintf(out, "  <graph id=\"%s\" edgedefault=\"directed\">\n", xmlEscape(name))
+
+	for _, node := range g.Nodes() {
+		fmt.Fprintf(out, "    <node id=\"%s\">\n", xmlEscape(node.URL))
+		fmt.Fprintf(out, "      <data key=\"title\">%s</data>\n", xmlEscape(node.Title))
+		fmt.Fprintf(out, "      <data key=\"status\">%d</data>\n", node.HTTPStatusCode)
+		fmt.Fprintf(out, "      <data key=\"kind\">%s</data>\n", node.Kind)
+		fmt.Fprintf(out, "      <data key=\"in_links\">%d</data>\n", node.InLinks)
+		fmt.Fprintln(out, "    </node>")
+	}
+
+	for _, edge := range g.Edges() {
+		fmt.Fprintf(out, "    <edge source=\"%s\" target=\"%s\">\n", xmlEscape(edge.Source), xmlEscape(edge.Target))
+		fmt.Fprintf(out, "      <data key=\"text\">%s</data>\n", xmlEscape(edge.Text))
+		fmt.Fprintf(out, "      <data key=\"rel\">%s</data>\n", xmlEscape(strings.Join(edge.Rel, " ")))
+		fmt.Fprintf(out, "      <data key=\"position\">%d</data>\n", edge.Position)
+		fmt.Fprintln(out, "    </edge>")
+	}
+
+	fmt.Fprintln(out, "  </graph>")
+	_, err := fmt.Fprintln(out, "</graphml>")
+	return err
+}
+
+// dotQuote returns s as a double-quoted DOT identifier
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// exportDOT writes the graph in the Graphviz DOT language
+// @see https://graphviz.org/doc/info/lang.html
+func exportDOT(out *bufio.Writer, name string, g *Graph) error {
+	fmt.Fprintf(out, "digraph %s {\n", dotQuote(name))
+	for _, node := range g.Nodes() {
+		fmt.Fprintf(out, "  %s [label=%s, status=%d];\n", dotQuote(node.URL), dotQuote(node.Title), node.HTTPStatusCode)
+	}
+
+	for _, edge := range g.Edges() {
+		fmt.Fprintf(out, "  %s -> %s [label=%s];\n", dotQuote(edge.Source), dotQuote(edge.Target), dotQuote(edge.Text))
+	}
+
+	_, err := fmt.Fprintln(out, "}")
+	return err
+}
+
+// exportCSV writes the edge list, one edge per row
+func exportCSV(out *bufio.Writer, g *Graph) error {
+	nodes := make(map[string]GraphNode)
+	for _, node := range g.Nodes() {
+		nodes[node.URL] = node
+	}
+
+	writer := csv.NewWriter(out)
+	writer.Write([]string{"source", "target", "text", "rel", "position", "status", "kind"})
+	for _, edge := range g.Edges() {
+		target := nodes[edge.Target]
+		writer.Write([]string{
+			edge.Source,
+			edge.Target,
+			edge.Text,
+			strings.Join(edge.Rel, " "),
+			strconv.Itoa(edge.Position),
+			strconv.Itoa(target.HTTPStatusCode),
+			string(target.Kind),
+		})
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// exportJSONL writes a JSON object per line, the nodes then the
+// edges, each tagged with its type
+func exportJSONL(out *bufio.Writer, g *Graph) error {
+	encoder := json.NewEncoder(out)
+	for _, node := range g.Nodes() {
+		line := struct {
+			Type string `json:"type"`
+			GraphNode
+		}{"node", node}
+
+		if err := encoder.Encode(line); err != nil {
+			return err
+		}
+	}
+
+	for _, edge := range g.Edges() {
+		line := struct {
+			Type string `json:"type"`
+			Edge
+		}{"edge", edge}
+
+		if err := encoder.Encode(line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
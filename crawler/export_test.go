@@ -0,0 +1,69 @@
+package crawler
+
+// module deps
+import "bytes"
+import "strings"
+import "testing"
+import "net/url"
+import "encoding/csv"
+import "encoding/xml"
+
+// exportWorker returns a worker with a small graph for tests
+func exportWorker() *Worker {
+	u, _ := url.Parse("http://example.com/")
+	g := NewGraph()
+	g.add(&ResourceRecord{URL: "http://example.com/", Title: `Home & "away"`, HTTPStatusCode: 200, Kind: KindPage, Links: []Edge{
+		{Source: "http://example.com/", Target: "http://example.com/a", Text: "A, <b>", Position: 0},
+		{Source: "http://example.com/", Target: "http://example.com/b", Text: "B", Rel: []string{"nofollow"}, Position: 1},
+	}})
+
+	return &Worker{seed: u, Graph: g}
+}
+
+// test Export renders every format
+func TestExport(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	worker := exportWorker()
+	render := func(format string) string {
+		var out bytes.Buffer
+		if err := worker.Export(&out, format); err != nil {
+			t.Fatalf("expected nil error for %v, got: %v\n", format, err)
+		}
+
+		return out.String()
+	}
+
+	var graphml struct {
+		Nodes []struct {
+			ID string `xml:"id,attr"`
+		} `xml:"graph>node"`
+		Edges []struct {
+			Source string `xml:"source,attr"`
+		} `xml:"graph>edge"`
+	}
+
+	if err := xml.Unmarshal([]byte(render(ExportGraphML)), &graphml); err != nil || len(graphml.Nodes) != 3 || len(graphml.Edges) != 2 {
+		t.Fatalf("expected 3 nodes & 2 edges, got: %v, error: %v\n", graphml, err)
+	}
+
+	dot := render(ExportDOT)
+	if !strings.HasPrefix(dot, `digraph "http://example.com/" {`) || strings.Count(dot, " -> ") != 2 || !strings.Contains(dot, `label="Home & \"away\""`) {
+		t.Fatalf("expected a digraph with 2 edges, got: %v\n", dot)
+	}
+
+	rows, err := csv.NewReader(strings.NewReader(render(ExportCSV))).ReadAll()
+	if err != nil || len(rows) != 3 || rows[1][2] != "A, <b>" || rows[2][3] != "nofollow" {
+		t.Fatalf("expected a header & 2 edges, got: %v, error: %v\n", rows, err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(render(ExportJSONL)), "\n")
+	if len(lines) != 5 || !strings.HasPrefix(lines[0], `{"type":"node"`) || !strings.HasPrefix(lines[4], `{"type":"edge"`) {
+		t.Fatalf("expected 3 nodes & 2 edges, got: %v\n", lines)
+	}
+
+	if err := worker.Export(&bytes.Buffer{}, "xls"); err != ErrUnsupportedFormat {
+		t.Fatalf("expected ErrUnsupportedFormat, got: %v\n", err)
+	}
+}
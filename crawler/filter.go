@@ -0,0 +1,113 @@
+package crawler
+
+// module deps
+import "fmt"
+import "regexp"
+import "strings"
+import "net/url"
+
+// prefix of the patterns which are regular expressions
+const regexpPrefix = "re:"
+
+// urlFilter decides which URLs of a crawl are enqueued, as per
+// its include & exclude patterns; a URL is enqueued when it
+// matches an include pattern, if any, and no exclude pattern
+type urlFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// newURLFilter compiles the patterns of a crawl; a pattern is a
+// regular expression when prefixed by re:, or a glob otherwise.
+// both are matched against the path, followed by ? & the query
+// when there is one. in a glob, * matches any run of characters
+// but /, ** matches any run of characters, and everything else
+// is literal; the glob matches the whole of the path & query
+func newURLFilter(include, exclude []string) (*urlFilter, error) {
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil, nil
+	}
+
+	var err error
+	f := &urlFilter{}
+	if f.include, err = compilePatterns(include); err != nil {
+		return nil, err
+	}
+
+	if f.exclude, err = compilePatterns(exclude); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// compilePatterns compiles the include or exclude patterns
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		expr := globToRegexp(pattern)
+		if strings.HasPrefix(pattern, regexpPrefix) {
+			expr = strings.TrimPrefix(pattern, regexpPrefix)
+		}
+
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+
+		compiled = append(compiled, re)
+	}
+
+	return compiled, nil
+}
+
+// globToRegexp returns the anchored regular expression of a glob
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			b.WriteString("[^/]*")
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+
+	b.WriteString("$")
+	return b.String()
+}
+
+// allows reports if the URL is to be enqueued; a nil filter
+// allows every URL
+func (f *urlFilter) allows(u *url.URL) bool {
+	if f == nil {
+		return true
+	}
+
+	target := u.EscapedPath()
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+
+	for _, re := range f.exclude {
+		if re.MatchString(target) {
+			return false
+		}
+	}
+
+	if len(f.include) == 0 {
+		return true
+	}
+
+	for _, re := range f.include {
+		if re.MatchString(target) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,93 @@
+package crawler
+
+// module deps
+import "testing"
+import "net/url"
+
+// test include & exclude patterns, globs and regular expressions
+func TestURLFilter(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	f, err := newURLFilter([]string{"/docs/**", "/blog/*", "re:^/20\\d\\d/"}, []string{"/docs/**/draft", "/search?*"})
+	if err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"http://example.com/docs/", true},
+		{"http://example.com/docs/a/b", true},
+		{"http://example.com/docs/a/draft", false},
+		{"http://example.com/blog/post", true},
+		{"http://example.com/blog/2020/post", false},
+		{"http://example.com/2020/01", true},
+		{"http://example.com/about", false},
+		{"http://example.com/docs/search?q=go", true},
+		{"http://example.com/search?q=go", false},
+	}
+
+	for _, test := range tests {
+		u, _ := url.Parse(test.url)
+		if allowed := f.allows(u); allowed != test.allowed {
+			t.Fatalf("expected %v for %v, got: %v\n", test.allowed, test.url, allowed)
+		}
+	}
+
+	// ? is literal in a glob
+	f, _ = newURLFilter(nil, []string{"/a?b"})
+	u, _ := url.Parse("http://example.com/axb")
+	if !f.allows(u) {
+		t.Fatalf("expected ? to be literal\n")
+	}
+
+	if _, err := newURLFilter([]string{"re:("}, nil); err == nil {
+		t.Fatalf("expected an invalid pattern error\n")
+	}
+}
+
+// test a crawl only enqueues the URLs allowed by its patterns
+func TestCrawlFilter(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	server := newTestSite(map[string]string{
+		"/":         `<title>Home</title><a href="/docs/">Docs</a><a href="/about">About</a>`,
+		"/docs/":    `<title>Docs</title><a href="/docs/a/b">B</a><a href="/search?q=go">Search</a>`,
+		"/docs/a/b": `<title>B</title>`,
+		"/about":    `<title>About</title>`,
+	})
+	defer server.Close()
+
+	c := New()
+	defer c.Close()
+
+	opts := Options{Depth: 3, Include: []string{"/docs/**", "/search?*"}, Exclude: []string{"/search?*"}}
+	if err := c.CrawlWithOptions(server.URL+"/", opts); err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	worker := c.Worker(server.URL + "/")
+	<-worker.Done()
+
+	fetched := make(map[string]bool)
+	var walk func(r *Resource)
+	walk = func(r *Resource) {
+		fetched[r.URL.Path] = true
+		for _, node := range r.Nodes {
+			walk(node)
+		}
+	}
+
+	walk(worker.Tree)
+	if len(fetched) != 3 || !fetched["/"] || !fetched["/docs/"] || !fetched["/docs/a/b"] {
+		t.Fatalf("expected the seed & the docs, got: %v\n", fetched)
+	}
+
+	opts = Options{Include: []string{"re:("}}
+	if err := c.CrawlWithOptions(server.URL+"/other", opts); err == nil {
+		t.Fatalf("expected an invalid pattern error\n")
+	}
+}
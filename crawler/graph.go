@@ -0,0 +1,158 @@
+package crawler
+
+// module deps
+import "sort"
+import "sync"
+import "encoding/json"
+
+// Edge describes a link from a page to a resource
+type Edge struct {
+	// URL of the page the link is on
+	Source string `json:"source"`
+
+	// absolute URL of the linked resource
+	Target string `json:"target"`
+
+	// visible anchor text
+	Text string `json:"text"`
+
+	// rel attribute values, lower cased
+	Rel []string `json:"rel,omitempty"`
+
+	// index of the anchor on the page, in document order
+	Position int `json:"position"`
+}
+
+// GraphNode describes a resource of the link graph
+type GraphNode struct {
+	// resource URL
+	URL string `json:"url"`
+
+	// from meta
+	Title string `json:"title"`
+
+	// HTTP StatusCode, 0 until fetched
+	HTTPStatusCode int `json:"status"`
+
+	// page, asset, redirect or error; empty until fetched
+	Kind ResourceKind `json:"kind,omitempty"`
+
+	// transport error or HTTP status of a failed fetch
+	Error string `json:"error,omitempty"`
+
+	// of the visible text of a page
+	SimHash uint64 `json:"simhash,string,omitempty"`
+
+	// redirects followed, or not
+	Redirects []Redirect `json:"redirects,omitempty"`
+
+	// from the meta robots tag & the X-Robots-Tag header
+	NoIndex  bool `json:"noindex,omitempty"`
+	NoFollow bool `json:"nofollow,omitempty"`
+
+	// links to the resource, and the distinct pages they are on
+	InLinks        int `json:"in_links"`
+	ReferringPages int `json:"referring_pages"`
+
+	// links on the page
+	OutLinks int `json:"out_links"`
+}
+
+// Graph is the link graph of a crawl; unlike the tree, which
+// records a resource under the first page it was found on,
+// every link is an edge. it is safe for concurrent use
+type Graph struct {
+	// mutex
+	mu sync.Mutex
+
+	// nodes by URL, including the linked
+	// resources which are not fetched
+	nodes map[string]*GraphNode
+
+	// edges in fetch order
+	edges []Edge
+
+	// distinct (source, target) pairs
+	pairs map[[2]string]struct{}
+}
+
+// NewGraph returns an empty Graph
+func NewGraph() *Graph {
+	return &Graph{
+		nodes: make(map[string]*GraphNode),
+		edges: make([]Edge, 0),
+		pairs: make(map[[2]string]struct{}),
+	}
+}
+
+// node returns the node of a URL, creating it on first use;
+// the caller holds the mutex
+func (g *Graph) node(uri string) *GraphNode {
+	node, exists := g.nodes[uri]
+	if !exists {
+		node = &GraphNode{URL: uri}
+		g.nodes[uri] = node
+	}
+
+	return node
+}
+
+// add records a fetched resource along with its links
+func (g *Graph) add(rr *ResourceRecord) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	node := g.node(rr.URL)
+	node.Title = rr.Title
+	node.HTTPStatusCode = rr.HTTPStatusCode
+	node.Kind = rr.Kind
+	node.Error = rr.Error
+	node.SimHash = rr.SimHash
+	node.Redirects = rr.Redirects
+	node.NoIndex = rr.NoIndex
+	node.NoFollow = rr.NoFollow
+	node.OutLinks = len(rr.Links)
+
+	for _, edge := range rr.Links {
+		target := g.node(edge.Target)
+		target.InLinks++
+
+		pair := [2]string{edge.Source, edge.Target}
+		if _, ok := g.pairs[pair]; !ok {
+			g.pairs[pair] = struct{}{}
+			target.ReferringPages++
+		}
+
+		g.edges = append(g.edges, edge)
+	}
+}
+
+// Nodes returns a copy of the nodes, sorted by URL
+func (g *Graph) Nodes() []GraphNode {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	nodes := make([]GraphNode, 0, len(g.nodes))
+	for _, node := range g.nodes {
+		nodes = append(nodes, *node)
+	}
+
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].URL < nodes[j].URL })
+	return nodes
+}
+
+// Edges returns a copy of the edges, in fetch order
+func (g *Graph) Edges() []Edge {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return append([]Edge(nil), g.edges...)
+}
+
+// MarshalJSON definition for Graph
+func (g *Graph) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Nodes []GraphNode `json:"nodes"`
+		Edges []Edge      `json:"edges"`
+	}{g.Nodes(), g.Edges()})
+}
@@ -0,0 +1,52 @@
+package crawler
+
+// module deps
+import "testing"
+import "encoding/json"
+
+// test Graph counts the links to every node
+func TestGraph(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	g := NewGraph()
+	g.add(&ResourceRecord{URL: "/", Title: "Home", HTTPStatusCode: 200, Kind: KindPage, Links: []Edge{
+		{Source: "/", Target: "/a", Text: "A", Position: 0},
+		{Source: "/", Target: "/a", Text: "More A", Position: 2},
+		{Source: "/", Target: "/b", Text: "B", Position: 3},
+	}})
+	g.add(&ResourceRecord{URL: "/a", Title: "A", HTTPStatusCode: 200, Kind: KindPage, Links: []Edge{
+		{Source: "/a", Target: "/b", Text: "B", Rel: []string{"nofollow"}, Position: 0},
+		{Source: "/a", Target: "/", Text: "Home", Position: 1},
+	}})
+
+	nodes := g.Nodes()
+	if len(nodes) != 3 || len(g.Edges()) != 5 {
+		t.Fatalf("expected 3 nodes & 5 edges, got: %v, %v\n", nodes, g.Edges())
+	}
+
+	expected := map[string][3]int{"/": {1, 1, 3}, "/a": {2, 1, 2}, "/b": {2, 2, 0}}
+	for _, node := range nodes {
+		if counts := [3]int{node.InLinks, node.ReferringPages, node.OutLinks}; counts != expected[node.URL] {
+			t.Fatalf("expected %v for %v, got: %v\n", expected[node.URL], node.URL, counts)
+		}
+	}
+
+	if nodes[2].HTTPStatusCode != 0 || nodes[2].Kind != "" {
+		t.Fatalf("expected /b not to be fetched, got: %v\n", nodes[2])
+	}
+
+	data, err := json.Marshal(g)
+	if err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	var decoded struct {
+		Nodes []GraphNode `json:"nodes"`
+		Edges []Edge      `json:"edges"`
+	}
+
+	if err = json.Unmarshal(data, &decoded); err != nil || len(decoded.Nodes) != 3 || len(decoded.Edges) != 5 {
+		t.Fatalf("expected nodes & edges, got: %s\n", data)
+	}
+}
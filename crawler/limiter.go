@@ -0,0 +1,302 @@
+package crawler
+
+// module deps
+import "sync"
+import "time"
+import "context"
+
+// weight of a response in the smoothed latency & error rate
+const adaptiveSmoothing = 0.2
+
+// Politeness describes the current pace of the requests to a host
+type Politeness struct {
+	// static or adaptive
+	Mode string
+
+	// min interval between requests
+	Delay time.Duration
+
+	// requests allowed in flight, 0 when unbounded
+	Concurrency int
+
+	// smoothed response latency, 0 until known
+	Latency time.Duration
+
+	// smoothed share of 429s, 5xx & transport errors
+	ErrorRate float64
+}
+
+// Rate returns the requests per second allowed to the host, as
+// bound by the delay, and by the concurrency at the latency; 0
+// when unbounded
+func (p Politeness) Rate() float64 {
+	rate := 0.0
+	if p.Delay > 0 {
+		rate = 1 / p.Delay.Seconds()
+	}
+
+	if p.Concurrency > 0 && p.Latency > 0 {
+		if r := float64(p.Concurrency) / p.Latency.Seconds(); rate == 0 || r < rate {
+			rate = r
+		}
+	}
+
+	return rate
+}
+
+// limiter spaces out the requests made to a single
+// host by at least delay; it is safe for concurrent
+// use by multiple goroutines of the same worker
+type limiter struct {
+	// mutex
+	mu sync.Mutex
+
+	// min interval between requests
+	interval time.Duration
+
+	// earliest time the next request can be made
+	next time.Time
+
+	// adjusts the interval & concurrency to the host
+	adaptive bool
+
+	// bounds of the interval when adaptive
+	floor   time.Duration
+	ceiling time.Duration
+
+	// requests allowed in flight, 0 when unbounded,
+	// up to maxConcurrency when adaptive
+	concurrency    int
+	maxConcurrency int
+
+	// requests in flight
+	active int
+
+	// closed & replaced when a slot is freed
+	wake chan struct{}
+
+	// smoothed response latency, short & long term
+	latency  time.Duration
+	baseline time.Duration
+
+	// smoothed share of 429s, 5xx & transport errors
+	errorRate float64
+
+	// healthy responses since the last adjustment
+	healthy int
+}
+
+// newLimiter returns a limiter for the given delay
+func newLimiter(delay time.Duration) *limiter {
+	return &limiter{interval: delay, wake: make(chan struct{})}
+}
+
+// newAdaptiveLimiter returns a limiter which starts at the floor
+// with a single request in flight; it backs off on errors and
+// rising latency, and speeds up back while the host is healthy
+func newAdaptiveLimiter(floor, ceiling time.Duration, concurrency int) *limiter {
+	return &limiter{
+		interval:       floor,
+		adaptive:       true,
+		floor:          floor,
+		ceiling:        ceiling,
+		concurrency:    1,
+		maxConcurrency: concurrency,
+		wake:           make(chan struct{}),
+	}
+}
+
+// reserve books the next free slot and returns
+// how long the caller has to wait for it
+func (l *limiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+
+	l.next = at.Add(l.interval)
+	return at.Sub(now)
+}
+
+// wait blocks until the caller is allowed to make a
+// request, or until the context is cancelled/expired
+func (l *limiter) wait(ctx context.Context) error {
+	wait := l.reserve()
+	if wait <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// acquire blocks until the caller may have one more request in
+// flight, or until the context is cancelled/expired; a nil error
+// is to be followed by a release
+func (l *limiter) acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.concurrency == 0 || l.active < l.concurrency {
+			l.active++
+			l.mu.Unlock()
+			return nil
+		}
+
+		wake := l.wake
+		l.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release frees the slot taken by acquire
+func (l *limiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.active--
+	l.broadcast()
+}
+
+// broadcast wakes up the callers waiting for a slot;
+// the caller holds the mutex
+func (l *limiter) broadcast() {
+	close(l.wake)
+	l.wake = make(chan struct{})
+}
+
+// pause holds off every request for at least d, as
+// asked by the host, e.g. by a 429 with Retry-After
+func (l *limiter) pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if at := time.Now().Add(d); at.After(l.next) {
+		l.next = at
+	}
+}
+
+// observe adjusts an adaptive limiter to the outcome of a request;
+// a 429, 5xx or transport error doubles the interval & halves the
+// concurrency, a latency well above its long term average slows
+// down by half as much, and as many healthy responses in a row as
+// requests allowed in flight speed up by a step
+func (l *limiter) observe(latency time.Duration, status int, err error) {
+	if !l.adaptive {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	failed := err != nil || status == 429 || status >= 500
+	sample := 0.0
+	if failed {
+		sample = 1
+	}
+
+	l.errorRate += adaptiveSmoothing * (sample - l.errorRate)
+	if err == nil {
+		if l.latency == 0 {
+			l.latency, l.baseline = latency, latency
+		}
+
+		l.latency += time.Duration(adaptiveSmoothing * float64(latency-l.latency))
+		l.baseline += time.Duration(adaptiveSmoothing / 10 * float64(latency-l.baseline))
+	}
+
+	switch {
+	case failed:
+		l.healthy = 0
+		l.slowDown(l.interval, l.concurrency/2)
+	case l.latency > 2*l.baseline:
+		l.healthy = 0
+		l.slowDown(l.interval/2, l.concurrency-1)
+	default:
+		l.healthy++
+		if l.healthy >= l.concurrency {
+			l.healthy = 0
+			l.speedUp()
+		}
+	}
+}
+
+// slowDown adds to the interval, at least a step, and lowers
+// the concurrency; both within bounds. the caller holds the mutex
+func (l *limiter) slowDown(step time.Duration, concurrency int) {
+	if step < AdaptiveDelayStep {
+		step = AdaptiveDelayStep
+	}
+
+	l.interval += step
+	if l.interval > l.ceiling {
+		l.interval = l.ceiling
+	}
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	l.concurrency = concurrency
+}
+
+// speedUp takes a quarter off the interval, down to the floor,
+// and allows one more request in flight, up to the max; the
+// caller holds the mutex
+func (l *limiter) speedUp() {
+	l.interval -= l.interval / 4
+	if l.interval < AdaptiveDelayStep {
+		l.interval = 0
+	}
+
+	if l.interval < l.floor {
+		l.interval = l.floor
+	}
+
+	if l.concurrency < l.maxConcurrency {
+		l.concurrency++
+		l.broadcast()
+	}
+}
+
+// delay returns the interval enforced by the limiter
+func (l *limiter) delay() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.interval
+}
+
+// state returns the current pace of the limiter
+func (l *limiter) state() Politeness {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	mode := PolitenessStatic
+	if l.adaptive {
+		mode = PolitenessAdaptive
+	}
+
+	return Politeness{
+		Mode:        mode,
+		Delay:       l.interval,
+		Concurrency: l.concurrency,
+		Latency:     l.latency,
+		ErrorRate:   l.errorRate,
+	}
+}
@@ -0,0 +1,81 @@
+package crawler
+
+// module deps
+import "time"
+import "errors"
+
+// politeness modes
+const (
+	PolitenessStatic   = "static"
+	PolitenessAdaptive = "adaptive"
+)
+
+// ErrUnsupportedPoliteness is used when the politeness mode is unknown
+var ErrUnsupportedPoliteness = errors.New("unsupported politeness mode")
+
+// Options describes the per-crawl settings of a worker
+type Options struct {
+	// max crawl depth; defaults to DefaultMaxCrawlDepth
+	Depth int
+
+	// overrides the robots.txt Crawl-delay when set, the
+	// delay is still bounded by the crawler's floor/ceiling
+	CrawlDelay time.Duration
+
+	// seeds the crawl with the robots.txt Sitemap
+	// directives, or /sitemap.xml in their absence
+	UseSitemaps bool
+
+	// writes the responses to a WARC file per run,
+	// under the crawler's archive directory
+	Archive bool
+
+	// per-request timeouts: overall, to connect, and between
+	// two reads of a response; DefaultRequestTimeout et al.
+	// when not set, a negative timeout disables it
+	RequestTimeout time.Duration
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+
+	// static, the default, keeps to the crawl delay; adaptive
+	// adjusts the delay & the requests in flight to the host
+	Politeness string
+
+	// patterns of the URLs to crawl & to skip, the seed
+	// aside; globs, or regular expressions when prefixed
+	// by re:, matched against the path & query
+	Include []string
+	Exclude []string
+
+	// links followed: on the seed's host, the default, on
+	// its registrable domain, on the seed's host or one of
+	// Hosts, or on the seed's host under the seed's path
+	Scope string
+	Hosts []string
+
+	// does not follow the links of a page whose visible
+	// text is a near-duplicate of a page crawled already
+	SkipDuplicates bool
+
+	// follows nofollow links & pages, and records the
+	// content of noindex pages; they are still flagged
+	Audit bool
+}
+
+// validate checks the settings which cannot be defaulted
+func (o Options) validate() error {
+	switch o.Politeness {
+	case "", PolitenessStatic, PolitenessAdaptive:
+	default:
+		return ErrUnsupportedPoliteness
+	}
+
+	switch o.Scope {
+	case "", ScopeHost, ScopeDomain, ScopeHosts, ScopePrefix:
+	default:
+		return ErrUnsupportedScope
+	}
+
+	_, err := newURLFilter(o.Include, o.Exclude)
+	return err
+}
@@ -0,0 +1,272 @@
+package crawler
+
+// module deps
+import "io"
+import "strings"
+import "net/url"
+import "golang.org/x/net/html"
+import "golang.org/x/net/html/atom"
+
+// Link describes an anchor found on a page
+type Link struct {
+	// raw href attribute
+	Href string `json:"href"`
+
+	// visible anchor text
+	Text string `json:"text"`
+
+	// rel attribute values, lower cased
+	Rel []string `json:"rel,omitempty"`
+
+	// rel includes nofollow
+	NoFollow bool `json:"nofollow,omitempty"`
+}
+
+// Meta describes a <meta> tag found on a page
+type Meta struct {
+	// name attribute
+	Name string `json:"name,omitempty"`
+
+	// property attribute (open graph et al.)
+	Property string `json:"property,omitempty"`
+
+	// http-equiv attribute
+	HTTPEquiv string `json:"http-equiv,omitempty"`
+
+	// content attribute
+	Content string `json:"content"`
+}
+
+// PageInfo is the structured content extracted from
+// a HTML document in a single pass over the stream
+type PageInfo struct {
+	// from <title>
+	Title string `json:"title"`
+
+	// anchors in document order
+	Links []Link `json:"links"`
+
+	// meta tags in document order
+	Meta []Meta `json:"meta"`
+
+	// from <link rel="canonical">
+	Canonical string `json:"canonical,omitempty"`
+
+	// from <base href>
+	BaseHref string `json:"base,omitempty"`
+
+	// from <meta name="robots">; none is both
+	NoIndex  bool `json:"noindex,omitempty"`
+	NoFollow bool `json:"nofollow,omitempty"`
+
+	// visible text of the document, whitespace collapsed;
+	// that is the text outside of the <title>, <script>,
+	// <style>, <noscript> & <template> elements
+	Text string `json:"text"`
+}
+
+// hidden reports if the text of the element is not visible
+func hidden(a atom.Atom) bool {
+	switch a {
+	case atom.Title, atom.Script, atom.Style, atom.Noscript, atom.Template:
+		return true
+	}
+
+	return false
+}
+
+// inline reports if the element is laid out within a line of text
+func inline(a atom.Atom) bool {
+	switch a {
+	case atom.A, atom.Abbr, atom.B, atom.Bdi, atom.Bdo, atom.Cite, atom.Code,
+		atom.Data, atom.Dfn, atom.Em, atom.I, atom.Kbd, atom.Mark, atom.Q, atom.S,
+		atom.Samp, atom.Small, atom.Span, atom.Strong, atom.Sub, atom.Sup,
+		atom.Time, atom.U, atom.Var:
+		return true
+	}
+
+	return false
+}
+
+// Base returns the URL that relative links on the page
+// resolve against; that is the document URL, unless the
+// page declares a <base href> in which case it is used
+func (p *PageInfo) Base(u *url.URL) *url.URL {
+	if p.BaseHref == "" {
+		return u
+	}
+
+	base, err := url.Parse(p.BaseHref)
+	if err != nil {
+		return u
+	}
+
+	return u.ResolveReference(base)
+}
+
+// attr returns the value of the named attribute of the token
+func attr(token html.Token, key string) (string, bool) {
+	for _, a := range token.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+
+	return "", false
+}
+
+// collapse trims and folds runs of whitespace into a single space
+func collapse(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// ParsePage tokenizes the HTML document exactly once and extracts
+// the title, links, meta tags, canonical, base href, robots
+// directives & visible text; the reader is consumed, but not
+// closed, and on error the page extracted so far is returned
+func ParsePage(doc io.Reader) (*PageInfo, error) {
+	page := &PageInfo{Links: make([]Link, 0), Meta: make([]Meta, 0)}
+
+	// parser state
+	var title, text, visible []string
+	var inTitle, seenTitle bool
+	var anchor = -1
+	var hiding = 0
+
+	tokenizer := html.NewTokenizer(doc)
+	for {
+		tt := tokenizer.Next()
+		switch tt {
+		case html.ErrorToken:
+			if anchor >= 0 {
+				page.Links[anchor].Text = collapse(strings.Join(text, ""))
+			}
+
+			if inTitle {
+				page.Title = collapse(strings.Join(title, ""))
+			}
+
+			page.Text = collapse(strings.Join(visible, ""))
+			if tokenizer.Err() == io.EOF {
+				return page, nil
+			}
+
+			return page, tokenizer.Err()
+
+		case html.TextToken:
+			// the tokenizer returns the text of a token only once
+			s := string(tokenizer.Text())
+			if inTitle {
+				title = append(title, s)
+			} else if anchor >= 0 {
+				text = append(text, s)
+			}
+
+			if hiding == 0 {
+				visible = append(visible, s)
+			}
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			if tt == html.StartTagToken && hidden(token.DataAtom) {
+				hiding++
+			}
+
+			// blocks are separated by whitespace in the visible text
+			if !inline(token.DataAtom) {
+				visible = append(visible, " ")
+			}
+
+			switch token.DataAtom {
+			case atom.Title:
+				if !seenTitle && tt == html.StartTagToken {
+					inTitle = true
+				}
+
+			case atom.A:
+				// anchors cannot be nested, an open anchor is implicitly closed
+				if anchor >= 0 {
+					page.Links[anchor].Text = collapse(strings.Join(text, ""))
+					anchor, text = -1, nil
+				}
+
+				href, ok := attr(token, "href")
+				if !ok {
+					continue
+				}
+
+				rel, _ := attr(token, "rel")
+				link := Link{Href: strings.TrimSpace(href), Rel: strings.Fields(strings.ToLower(rel))}
+				for _, r := range link.Rel {
+					link.NoFollow = link.NoFollow || r == "nofollow"
+				}
+
+				page.Links = append(page.Links, link)
+
+				if tt == html.StartTagToken {
+					anchor = len(page.Links) - 1
+				}
+
+			case atom.Img:
+				// alt text of images is the anchor text of image links
+				if alt, ok := attr(token, "alt"); ok && anchor >= 0 {
+					text = append(text, " "+alt+" ")
+				}
+
+			case atom.Base:
+				if href, ok := attr(token, "href"); ok && page.BaseHref == "" {
+					page.BaseHref = strings.TrimSpace(href)
+				}
+
+			case atom.Link:
+				rel, _ := attr(token, "rel")
+				for _, r := range strings.Fields(strings.ToLower(rel)) {
+					if r == "canonical" && page.Canonical == "" {
+						href, _ := attr(token, "href")
+						page.Canonical = strings.TrimSpace(href)
+					}
+				}
+
+			case atom.Meta:
+				meta := Meta{}
+				meta.Name, _ = attr(token, "name")
+				meta.Property, _ = attr(token, "property")
+				meta.HTTPEquiv, _ = attr(token, "http-equiv")
+				meta.Content, _ = attr(token, "content")
+				if meta.Name != "" || meta.Property != "" || meta.HTTPEquiv != "" {
+					page.Meta = append(page.Meta, meta)
+				}
+
+				if strings.EqualFold(meta.Name, "robots") {
+					noindex, nofollow := robotsDirectives(meta.Content)
+					page.NoIndex = page.NoIndex || noindex
+					page.NoFollow = page.NoFollow || nofollow
+				}
+			}
+
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			if hidden(atom.Lookup(name)) && hiding > 0 {
+				hiding--
+			}
+
+			if !inline(atom.Lookup(name)) {
+				visible = append(visible, " ")
+			}
+
+			switch atom.Lookup(name) {
+			case atom.Title:
+				if inTitle {
+					page.Title = collapse(strings.Join(title, ""))
+					inTitle, seenTitle = false, true
+				}
+
+			case atom.A:
+				if anchor >= 0 {
+					page.Links[anchor].Text = collapse(strings.Join(text, ""))
+					anchor, text = -1, nil
+				}
+			}
+		}
+	}
+}
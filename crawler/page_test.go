@@ -0,0 +1,126 @@
+package crawler
+
+// module deps
+import "strings"
+import "testing"
+import "net/url"
+
+// test ParsePage title
+func TestParsePageTitle(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	doc := strings.NewReader(`<meta charset="UTF-8"><title>Example Title</title>`)
+	page, err := ParsePage(doc)
+
+	if err != nil || page.Title != "Example Title" {
+		t.Fatalf("expected Example Title, got: %v\n", page.Title)
+	}
+}
+
+// test ParsePage extracts links on either side of the title
+func TestParsePageLinks(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	doc := strings.NewReader(`<html><head>
+		<a href="/before">Before</a>
+		<title>Example Title</title>
+		<link rel="Canonical" href="http://example.com/page">
+		<meta name="description" content="Example Description">
+		<base href="http://example.com/sub/">
+		</head><body>
+		<a href="after" rel="nofollow noopener">After <b>the</b>
+			title</a>
+		<a href="/image"><img src="/image.png" alt="Image"></a>
+		<a name="anchor">No Href</a>
+		</body></html>`)
+	page, err := ParsePage(doc)
+
+	if err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	if page.Title != "Example Title" {
+		t.Fatalf("expected Example Title, got: %v\n", page.Title)
+	}
+
+	expected := []Link{
+		{Href: "/before", Text: "Before"},
+		{Href: "after", Text: "After the title", Rel: []string{"nofollow", "noopener"}},
+		{Href: "/image", Text: "Image"},
+	}
+
+	if len(page.Links) != len(expected) {
+		t.Fatalf("expected %d links, got: %v\n", len(expected), page.Links)
+	}
+
+	for i, link := range expected {
+		got := page.Links[i]
+		if got.Href != link.Href || got.Text != link.Text || strings.Join(got.Rel, " ") != strings.Join(link.Rel, " ") {
+			t.Fatalf("expected %v, got: %v\n", link, got)
+		}
+	}
+
+	if page.Canonical != "http://example.com/page" {
+		t.Fatalf("expected canonical http://example.com/page, got: %v\n", page.Canonical)
+	}
+
+	if len(page.Meta) != 1 || page.Meta[0].Content != "Example Description" {
+		t.Fatalf("expected description meta, got: %v\n", page.Meta)
+	}
+
+	u, _ := url.Parse("http://example.com/")
+	if base := page.Base(u).String(); base != "http://example.com/sub/" {
+		t.Fatalf("expected base http://example.com/sub/, got: %v\n", base)
+	}
+}
+
+// test ParsePage extracts the visible text
+func TestParsePageText(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	doc := strings.NewReader(`<html><head><title>Title</title><style>p { color: red }</style></head>
+		<body><p>First</p><script>var hidden = 1;</script><p>Second <b>para</b>graph</p>
+		<noscript>Enable JavaScript</noscript></body></html>`)
+	page, err := ParsePage(doc)
+
+	if err != nil || page.Text != "First Second paragraph" {
+		t.Fatalf("expected the visible text, got: %v\n", page.Text)
+	}
+}
+
+// test ParsePage includes the text of links in the visible text
+func TestParsePageLinkText(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	page, err := ParsePage(strings.NewReader(`<p>hello <a href="/x">link words</a> world</p>`))
+
+	if err != nil || page.Text != "hello link words world" {
+		t.Fatalf("expected the text of the link, got: %v\n", page.Text)
+	}
+
+	if len(page.Links) != 1 || page.Links[0].Text != "link words" {
+		t.Fatalf("expected 1 link with its text, got: %v\n", page.Links)
+	}
+}
+
+// test ParsePage extracts the robots directives of the page & its links
+func TestParsePageDirectives(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	doc := strings.NewReader(`<html><head><meta name="Robots" content="noindex, NoFollow"></head>
+		<body><a href="/a" rel="nofollow">A</a><a href="/b" rel="external">B</a></body></html>`)
+	page, err := ParsePage(doc)
+
+	if err != nil || !page.NoIndex || !page.NoFollow {
+		t.Fatalf("expected noindex & nofollow, got: %v\n", page)
+	}
+
+	if len(page.Links) != 2 || !page.Links[0].NoFollow || page.Links[1].NoFollow {
+		t.Fatalf("expected the first link to be nofollow, got: %v\n", page.Links)
+	}
+}
@@ -0,0 +1,65 @@
+package crawler
+
+// module deps
+import "errors"
+import "context"
+import "net/http"
+
+// ErrRedirectLoop is used when a redirect leads back to a URL of its chain
+var ErrRedirectLoop = errors.New("redirect loop")
+
+// ErrTooManyRedirects is used when a redirect chain exceeds the max hops
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+// Redirect describes a hop of a redirect chain
+type Redirect struct {
+	// URL that responded with the redirect
+	URL string `json:"url"`
+
+	// HTTP StatusCode, 3xx
+	HTTPStatusCode int `json:"status"`
+
+	// URL it redirected to
+	Location string `json:"location"`
+}
+
+// redirectsKey is the context key of the redirects of a request
+type redirectsKey struct{}
+
+// withRedirects returns the request, recording its redirect chain
+// in redirects as it is followed
+func withRedirects(req *http.Request, redirects *[]Redirect) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), redirectsKey{}, redirects))
+}
+
+// checkRedirect returns the redirect policy of a crawl; every hop is
+// recorded, and a redirect is followed unless it leads back to a URL
+// of its chain, exceeds the crawler's max hops, or leads out of the
+// crawl's scope. in the latter case the redirect is the response
+func (c *Crawler) checkRedirect(worker *Worker) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if redirects, ok := req.Context().Value(redirectsKey{}).(*[]Redirect); ok {
+			*redirects = append(*redirects, Redirect{
+				URL:            via[len(via)-1].URL.String(),
+				HTTPStatusCode: req.Response.StatusCode,
+				Location:       req.URL.String(),
+			})
+		}
+
+		for _, prev := range via {
+			if prev.URL.String() == req.URL.String() {
+				return ErrRedirectLoop
+			}
+		}
+
+		if c.MaxRedirects > 0 && len(via) > c.MaxRedirects {
+			return ErrTooManyRedirects
+		}
+
+		if !worker.scope.allows(c.Canonicalizer.Canonical(req.URL)) {
+			return http.ErrUseLastResponse
+		}
+
+		return nil
+	}
+}
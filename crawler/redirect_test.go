@@ -0,0 +1,130 @@
+package crawler
+
+// module deps
+import "sync"
+import "testing"
+import "net/http"
+import "net/http/httptest"
+
+// newRedirectSite returns a test site which redirects the
+// paths of redirects, and serves the pages otherwise
+func newRedirectSite(redirects, pages map[string]string) *httptest.Server {
+	site := newTestSite(pages)
+	site.Close()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if location, ok := redirects[r.URL.Path]; ok {
+			http.Redirect(w, r, location, http.StatusMovedPermanently)
+			return
+		}
+
+		site.Config.Handler.ServeHTTP(w, r)
+	}))
+}
+
+// test a crawl records redirect chains, resolves links against
+// the final URL, and does not follow redirects out of scope
+func TestCrawlRedirects(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	var mu sync.Mutex
+	fetched := 0
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetched++
+		mu.Unlock()
+	}))
+	defer other.Close()
+
+	server := newRedirectSite(map[string]string{
+		"/old":   "/docs/",
+		"/loop":  "/loop2",
+		"/loop2": "/loop",
+		"/out":   other.URL + "/",
+		"/long":  "/l1",
+		"/l1":    "/l2",
+		"/l2":    "/new",
+	}, map[string]string{
+		"/":          `<title>Home</title><a href="/old">Old</a><a href="/loop">Loop</a><a href="/out">Out</a><a href="/long">Long</a>`,
+		"/docs/":     `<title>Docs</title><a href="page">Page</a>`,
+		"/docs/page": `<title>Page</title>`,
+		"/new":       `<title>New</title>`,
+	})
+	defer server.Close()
+
+	c := New()
+	defer c.Close()
+
+	if err := c.Crawl(server.URL+"/", 3); err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	worker := c.Worker(server.URL + "/")
+	<-worker.Done()
+
+	nodes := make(map[string]*Resource)
+	for _, node := range worker.Tree.Nodes {
+		nodes[node.URLString] = node
+	}
+
+	old := nodes[server.URL+"/old"]
+	if old == nil || old.Kind != KindPage || old.FinalURL != server.URL+"/docs/" || len(old.Redirects) != 1 || old.Redirects[0].HTTPStatusCode != 301 {
+		t.Fatalf("expected /old to redirect to /docs/, got: %v\n", old)
+	}
+
+	if len(old.Nodes) != 1 || old.Nodes[0].URLString != server.URL+"/docs/page" {
+		t.Fatalf("expected the links of /docs/ to resolve against it, got: %v\n", old.Nodes)
+	}
+
+	loop := nodes[server.URL+"/loop"]
+	if loop == nil || loop.Kind != KindError || len(loop.Redirects) != 2 || loop.Attempts != 1 {
+		t.Fatalf("expected /loop to fail once as a loop, got: %v\n", loop)
+	}
+
+	out := nodes[server.URL+"/out"]
+	if out == nil || out.Kind != KindRedirect || out.HTTPStatusCode != 301 || fetched != 0 {
+		t.Fatalf("expected /out not to be followed, got: %v, %d\n", out, fetched)
+	}
+
+	long := nodes[server.URL+"/long"]
+	if long == nil || long.Kind != KindPage || long.Title != "New" || len(long.Redirects) != 3 {
+		t.Fatalf("expected /long to redirect to /new, got: %v\n", long)
+	}
+
+	chains := worker.RedirectChains(1)
+	if len(chains) != 2 || chains[0].URL != server.URL+"/long" || chains[0].Loop || chains[1].URL != server.URL+"/loop" || !chains[1].Loop {
+		t.Fatalf("expected /long and the /loop, got: %v\n", chains)
+	}
+}
+
+// test a crawl follows at most MaxRedirects hops
+func TestMaxRedirects(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	server := newRedirectSite(map[string]string{
+		"/a": "/b",
+		"/b": "/c",
+		"/c": "/d",
+	}, map[string]string{
+		"/":  `<title>Home</title><a href="/a">A</a>`,
+		"/d": `<title>D</title>`,
+	})
+	defer server.Close()
+
+	c := New()
+	defer c.Close()
+
+	c.MaxRedirects = 2
+	if err := c.Crawl(server.URL+"/", 2); err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	worker := c.Worker(server.URL + "/")
+	<-worker.Done()
+
+	if len(worker.Tree.Nodes) != 1 || worker.Tree.Nodes[0].Kind != KindError || len(worker.Tree.Nodes[0].Redirects) != 3 {
+		t.Fatalf("expected /a to fail with too many redirects, got: %v\n", worker.Tree.Nodes)
+	}
+}
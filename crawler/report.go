@@ -0,0 +1,195 @@
+package crawler
+
+// Referrer describes a link to a resource, found on a page
+type Referrer struct {
+	// URL of the referring page
+	URL string `json:"url"`
+
+	// visible anchor text of the link
+	Text string `json:"text"`
+}
+
+// BrokenLink describes a resource that responded 4xx / 5xx
+// or could not be fetched, along with the links to it
+type BrokenLink struct {
+	// resource URL
+	URL string `json:"url"`
+
+	// HTTP StatusCode, 0 on a transport error
+	HTTPStatusCode int `json:"status"`
+
+	// transport error or HTTP status
+	Error string `json:"error"`
+
+	// pages linking to the resource, in fetch order
+	Referrers []Referrer `json:"referrers"`
+}
+
+// BrokenLinks reports the broken links of the current run, sorted
+// by URL; unlike the tree, which records a resource under the first
+// page that it was found on, every page linking to it is reported
+func (w *Worker) BrokenLinks() []*BrokenLink {
+	broken := make(map[string]*BrokenLink)
+	reports := make([]*BrokenLink, 0)
+	for _, node := range w.Graph.Nodes() {
+		if node.Kind == KindError {
+			report := &BrokenLink{
+				URL:            node.URL,
+				HTTPStatusCode: node.HTTPStatusCode,
+				Error:          node.Error,
+				Referrers:      make([]Referrer, 0),
+			}
+
+			broken[node.URL] = report
+			reports = append(reports, report)
+		}
+	}
+
+	// a page linking twice with the same text is reported once
+	seen := make(map[[3]string]struct{})
+	for _, edge := range w.Graph.Edges() {
+		report, ok := broken[edge.Target]
+		if !ok {
+			continue
+		}
+
+		key := [3]string{edge.Target, edge.Source, edge.Text}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+
+		seen[key] = struct{}{}
+		report.Referrers = append(report.Referrers, Referrer{URL: edge.Source, Text: edge.Text})
+	}
+
+	return reports
+}
+
+// DuplicatePage describes a page of a group of near-duplicates
+type DuplicatePage struct {
+	// page URL
+	URL string `json:"url"`
+
+	// from meta
+	Title string `json:"title"`
+
+	// Hamming distance of its SimHash to the first page's
+	Distance int `json:"distance"`
+}
+
+// DuplicateGroup describes pages whose visible text is identical
+// or nearly so, such as print views or URLs with session ids
+type DuplicateGroup struct {
+	// SimHash of the first page
+	SimHash uint64 `json:"simhash,string"`
+
+	// pages of the group, sorted by URL
+	Pages []DuplicatePage `json:"pages"`
+}
+
+// Duplicates reports the groups of near-duplicate pages of the
+// current run, sorted by their first URL; two pages are near-
+// duplicates when their SimHashes are within the distance, and
+// so are the pages they are near-duplicates of, transitively
+func (w *Worker) Duplicates(distance int) []*DuplicateGroup {
+	nodes := make([]GraphNode, 0)
+	for _, node := range w.Graph.Nodes() {
+		if node.Kind == KindPage && node.SimHash != 0 {
+			nodes = append(nodes, node)
+		}
+	}
+
+	// union-find over the pairs of near-duplicates
+	parent := make([]int, len(nodes))
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+
+		return parent[i]
+	}
+
+	index := newSimIndex(distance)
+	for i, node := range nodes {
+		parent[i] = i
+		for _, j := range index.matches(node.SimHash) {
+			if a, b := find(i), find(j); a != b {
+				parent[a] = b
+			}
+		}
+
+		index.insert(node.URL, node.SimHash)
+	}
+
+	groups := make(map[int]*DuplicateGroup)
+	reports := make([]*DuplicateGroup, 0)
+	for i, node := range nodes {
+		root := find(i)
+		group, ok := groups[root]
+		if !ok {
+			group = &DuplicateGroup{SimHash: node.SimHash, Pages: make([]DuplicatePage, 0)}
+			groups[root] = group
+			reports = append(reports, group)
+		}
+
+		group.Pages = append(group.Pages, DuplicatePage{
+			URL:      node.URL,
+			Title:    node.Title,
+			Distance: hammingDistance(group.SimHash, node.SimHash),
+		})
+	}
+
+	// a page without near-duplicates is not a group
+	duplicates := make([]*DuplicateGroup, 0)
+	for _, group := range reports {
+		if len(group.Pages) > 1 {
+			duplicates = append(duplicates, group)
+		}
+	}
+
+	return duplicates
+}
+
+// RedirectChain describes the redirects of a resource
+type RedirectChain struct {
+	// resource URL
+	URL string `json:"url"`
+
+	// hops in the order they were followed
+	Redirects []Redirect `json:"redirects"`
+
+	// the last hop leads back to a URL of the chain
+	Loop bool `json:"loop"`
+}
+
+// loops reports if the last hop of the redirects leads back to a
+// URL of the chain
+func loops(redirects []Redirect) bool {
+	if len(redirects) == 0 {
+		return false
+	}
+
+	last := redirects[len(redirects)-1].Location
+	for _, hop := range redirects {
+		if hop.URL == last {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RedirectChains reports the redirect loops of the current run, and
+// the redirect chains of more than max hops, sorted by URL
+func (w *Worker) RedirectChains(max int) []*RedirectChain {
+	reports := make([]*RedirectChain, 0)
+	for _, node := range w.Graph.Nodes() {
+		loop := loops(node.Redirects)
+		if loop || len(node.Redirects) > max {
+			reports = append(reports, &RedirectChain{URL: node.URL, Redirects: node.Redirects, Loop: loop})
+		}
+	}
+
+	return reports
+}
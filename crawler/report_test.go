@@ -0,0 +1,96 @@
+package crawler
+
+// module deps
+import "testing"
+
+// test BrokenLinks reports every referrer of a broken link
+func TestBrokenLinks(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	server := newTestSite(map[string]string{
+		"/":  `<title>Home</title><a href="/a">A</a><a href="/missing">Gone</a><a href="/missing">Gone</a>`,
+		"/a": `<title>A</title><a href="/missing">Still <b>gone</b></a>`,
+	})
+	defer server.Close()
+
+	c := New()
+	defer c.Close()
+
+	if err := c.Crawl(server.URL+"/", 3); err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	worker := c.Worker(server.URL + "/")
+	<-worker.Done()
+
+	reports := worker.BrokenLinks()
+	if len(reports) != 1 || reports[0].URL != server.URL+"/missing" || reports[0].HTTPStatusCode != 404 {
+		t.Fatalf("expected /missing to be broken, got: %v\n", reports)
+	}
+
+	referrers := make(map[Referrer]bool)
+	for _, referrer := range reports[0].Referrers {
+		referrers[referrer] = true
+	}
+
+	if len(referrers) != 2 || !referrers[Referrer{server.URL + "/", "Gone"}] || !referrers[Referrer{server.URL + "/a", "Still gone"}] {
+		t.Fatalf("expected 2 referrers, got: %v\n", reports[0].Referrers)
+	}
+}
+
+// test Duplicates groups the pages with near-identical text
+func TestDuplicates(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	article := `<title>Article</title><p>The quick brown fox jumps over the lazy dog, again and again, until the dog finally wakes up.</p>`
+	server := newTestSite(map[string]string{
+		"/":  `<title>Home</title><a href="/a">A</a><a href="/a?print=1">Print</a><a href="/b">B</a>`,
+		"/a": article + `<a href="/c">C</a>`,
+		"/b": `<title>B</title><p>Something else entirely, with no words in common with any other page of the site.</p>`,
+		"/c": `<title>C</title>`,
+	})
+	defer server.Close()
+
+	c := New()
+	defer c.Close()
+
+	if err := c.CrawlWithOptions(server.URL+"/", Options{Depth: 3, SkipDuplicates: true}); err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	worker := c.Worker(server.URL + "/")
+	<-worker.Done()
+
+	groups := worker.Duplicates(DefaultSimHashDistance)
+	if len(groups) != 1 || len(groups[0].Pages) != 2 || groups[0].Pages[0].URL != server.URL+"/a" || groups[0].Pages[1].URL != server.URL+"/a?print=1" {
+		t.Fatalf("expected /a & its print view, got: %v\n", groups)
+	}
+
+	// the print view & the page are fetched in any order, the second
+	// is the duplicate, and its link is recorded but not followed
+	duplicates := 0
+	for _, node := range worker.Tree.Nodes {
+		if node.DuplicateOf != "" {
+			duplicates++
+			if len(node.Nodes) != 0 {
+				t.Fatalf("expected the links of a duplicate not to be followed, got: %v\n", node.Nodes)
+			}
+
+			if len(node.links) != 1 || node.links[0].Target != server.URL+"/c" {
+				t.Fatalf("expected the links of a duplicate to be recorded, got: %v\n", node.links)
+			}
+		}
+	}
+
+	if duplicates != 1 {
+		t.Fatalf("expected 1 duplicate, got: %d\n", duplicates)
+	}
+
+	for _, node := range worker.Graph.Nodes() {
+		if node.URL == server.URL+"/c" && node.ReferringPages != 2 {
+			t.Fatalf("expected /c to be linked from /a & its print view, got: %v\n", node)
+		}
+	}
+}
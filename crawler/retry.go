@@ -0,0 +1,180 @@
+package crawler
+
+// module deps
+import "io"
+import "time"
+import "errors"
+import "strconv"
+import "net/http"
+import "io/ioutil"
+import "math/rand"
+
+// RetryPolicy describes when & how a failed request is retried;
+// transport errors and the retryable statuses are retried with an
+// exponential backoff, unless the response asks for a Retry-After
+type RetryPolicy struct {
+	// attempts per request, including the first; 1 disables retries
+	MaxAttempts int
+
+	// backoff of the first retry, doubled on every further
+	// retry, of which a random half is taken off as jitter
+	BaseDelay time.Duration
+
+	// ceiling of the backoff; a Retry-After beyond it is not waited for
+	MaxDelay time.Duration
+
+	// statuses that are retried
+	RetryableStatus []int
+}
+
+// DefaultRetryPolicy returns the policy of a new Crawler
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    30 * time.Second,
+		RetryableStatus: []int{
+			http.StatusRequestTimeout,
+			http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+	}
+}
+
+// backoff returns the delay before the retry that follows the attempt
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay << uint(attempt-1)
+	if d <= 0 || (p.MaxDelay > 0 && d > p.MaxDelay) {
+		d = p.MaxDelay
+	}
+
+	if d <= 0 {
+		return 0
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryAfter parses the Retry-After header, either in
+// seconds or as a HTTP date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d, true
+		}
+
+		return 0, true
+	}
+
+	return 0, false
+}
+
+// retry reports if the outcome of the attempt is to be retried,
+// and how long to wait for before
+func (p *RetryPolicy) retry(resp *http.Response, err error, attempt int) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts {
+		return 0, false
+	}
+
+	// a redirect the policy refuses to follow fails the same way again
+	if errors.Is(err, ErrRedirectLoop) || errors.Is(err, ErrTooManyRedirects) {
+		return 0, false
+	}
+
+	if err != nil {
+		return p.backoff(attempt), true
+	}
+
+	retryable := false
+	for _, status := range p.RetryableStatus {
+		retryable = retryable || status == resp.StatusCode
+	}
+
+	if !retryable {
+		return 0, false
+	}
+
+	if d, ok := retryAfter(resp); ok {
+		return d, p.MaxDelay <= 0 || d <= p.MaxDelay
+	}
+
+	return p.backoff(attempt), true
+}
+
+// send makes the request of a resource, retrying it as per the
+// crawler's retry policy; the delay of a 429 applies to every
+// request to the host, other delays only to the request. every
+// attempt is observed by the host's limiter, and the number of
+// attempts, as well as the redirects of the last, are recorded
+// on the resource; it is called, and returns, holding a slot of
+// the crawler's throttle
+func (c *Crawler) send(resource *Resource, req *http.Request) (*http.Response, error) {
+	worker := resource.worker
+	policy := c.Retry
+	req = withRedirects(req, &resource.Redirects)
+	for attempt := 1; ; attempt++ {
+		resource.Attempts = attempt
+		resource.Redirects = nil
+		sent := time.Now()
+		resp, err := worker.do(req)
+		if worker.ctx.Err() != nil {
+			return resp, err
+		}
+
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+
+		worker.limiter.observe(time.Since(sent), status, err)
+
+		delay, retry := policy.retry(resp, err, attempt)
+		if !retry {
+			return resp, err
+		}
+
+		if resp != nil {
+			io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+		}
+
+		// the throttle slot is given up while waiting to retry, so
+		// that a failing host does not hold up the slots of others
+		<-c.throttle
+		err = worker.backoff(status, delay)
+		c.throttle <- true
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// backoff waits for the delay before the retry of a request, and
+// for the host's limiter; the delay of a 429 pauses the limiter
+func (w *Worker) backoff(status int, delay time.Duration) error {
+	if status == http.StatusTooManyRequests {
+		w.limiter.pause(delay)
+	} else if delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-w.ctx.Done():
+			timer.Stop()
+			return w.ctx.Err()
+		}
+	}
+
+	return w.limiter.wait(w.ctx)
+}
@@ -0,0 +1,124 @@
+package crawler
+
+// module deps
+import "sync"
+import "time"
+import "testing"
+import "net/http"
+import "net/http/httptest"
+
+// test retryAfter parses seconds & HTTP dates
+func TestRetryAfter(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	resp := &http.Response{Header: http.Header{}}
+	if _, ok := retryAfter(resp); ok {
+		t.Fatalf("expected no Retry-After\n")
+	}
+
+	resp.Header.Set("Retry-After", "2")
+	if d, ok := retryAfter(resp); !ok || d != 2*time.Second {
+		t.Fatalf("expected 2s, got: %v\n", d)
+	}
+
+	resp.Header.Set("Retry-After", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	if d, ok := retryAfter(resp); !ok || d < 59*time.Minute {
+		t.Fatalf("expected about 1h, got: %v\n", d)
+	}
+
+	policy := DefaultRetryPolicy()
+	if _, retry := policy.retry(resp, nil, 1); retry {
+		t.Fatalf("expected not to wait beyond MaxDelay\n")
+	}
+}
+
+// test fetch retries transient failures
+func TestRetry(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	// the seed responds 503, then 429, then succeeds
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: *\nAllow: /\n"))
+			return
+		}
+
+		mu.Lock()
+		requests++
+		n := requests
+		mu.Unlock()
+
+		switch n {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<title>Home</title>`))
+		}
+	}))
+	defer server.Close()
+
+	c := New()
+	defer c.Close()
+	c.Retry.BaseDelay = time.Millisecond
+
+	if err := c.Crawl(server.URL+"/", 1); err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	worker := c.Worker(server.URL + "/")
+	<-worker.Done()
+
+	if worker.Tree.Kind != KindPage || worker.Tree.Title != "Home" || worker.Tree.Attempts != 3 || requests != 3 {
+		t.Fatalf("expected the page after 3 requests, got: %v, %v after %d\n", worker.Tree.Kind, worker.Tree.Title, requests)
+	}
+}
+
+// test a host waiting to retry does not hold up the throttle
+func TestRetryReleasesThrottle(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	// the failing host asks every request to be retried after 1s
+	failed := make(chan struct{}, 3)
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: *\nAllow: /\n"))
+			return
+		}
+
+		failed <- struct{}{}
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	server := newTestSite(map[string]string{"/": `<title>Home</title>`})
+	defer server.Close()
+
+	c := New()
+	defer c.Close()
+	c.throttle = make(chan bool, 1)
+
+	if err := c.Crawl(failing.URL+"/", 1); err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	<-failed
+	if err := c.Crawl(server.URL+"/", 1); err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	select {
+	case <-c.Worker(server.URL + "/").Done():
+	case <-time.After(time.Second):
+		t.Fatalf("expected the crawl not to wait for the retries of another host\n")
+	}
+}
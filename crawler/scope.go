@@ -0,0 +1,99 @@
+package crawler
+
+// module deps
+import "net"
+import "sync"
+import "errors"
+import "strings"
+import "net/url"
+import "golang.org/x/net/publicsuffix"
+import "github.com/temoto/robotstxt-go"
+
+// crawl scopes
+const (
+	ScopeHost   = "host"
+	ScopeDomain = "domain"
+	ScopeHosts  = "hosts"
+	ScopePrefix = "prefix"
+)
+
+// ErrUnsupportedScope is used when the crawl scope is unknown
+var ErrUnsupportedScope = errors.New("unsupported crawl scope")
+
+// scope decides which links of a crawl are followed: those on the
+// seed's host, on the seed's registrable domain, on a host of the
+// allowlist, or on the seed's host & under the seed's path
+type scope struct {
+	kind string
+
+	// seed URL
+	seed *url.URL
+
+	// registrable domain of the seed, e.g. example.co.uk
+	domain string
+
+	// allowed hosts, lower cased
+	hosts map[string]struct{}
+}
+
+// newScope returns the scope of a crawl; the seed's host is in
+// every scope, including an allowlist which does not name it
+func newScope(seed *url.URL, opts Options) *scope {
+	s := &scope{kind: opts.Scope, seed: seed, hosts: make(map[string]struct{})}
+	if s.kind == "" {
+		s.kind = ScopeHost
+	}
+
+	s.hosts[strings.ToLower(seed.Host)] = struct{}{}
+	for _, host := range opts.Hosts {
+		s.hosts[strings.ToLower(host)] = struct{}{}
+	}
+
+	s.domain = registrableDomain(seed.Hostname())
+	return s
+}
+
+// registrableDomain returns the public suffix of the host, plus one
+// label; the host itself when it is an IP or has no such domain
+// @see https://publicsuffix.org/
+func registrableDomain(host string) string {
+	host = strings.ToLower(host)
+	if net.ParseIP(host) != nil {
+		return host
+	}
+
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+
+	return domain
+}
+
+// allows reports if the URL is in scope
+func (s *scope) allows(u *url.URL) bool {
+	host := strings.ToLower(u.Host)
+	switch s.kind {
+	case ScopeDomain:
+		return registrableDomain(u.Hostname()) == s.domain
+	case ScopeHosts:
+		_, ok := s.hosts[host]
+		return ok
+	case ScopePrefix:
+		if host != strings.ToLower(s.seed.Host) {
+			return false
+		}
+
+		prefix := strings.TrimSuffix(s.seed.Path, "/")
+		return u.Path == prefix || strings.HasPrefix(u.Path, prefix+"/")
+	}
+
+	return host == strings.ToLower(s.seed.Host)
+}
+
+// hostRobots is the robots.txt group of a host in scope, other
+// than the seed's, looked up once on first use
+type hostRobots struct {
+	once  sync.Once
+	agent *robotstxt.Group
+}
@@ -0,0 +1,92 @@
+package crawler
+
+// module deps
+import "sync"
+import "testing"
+import "net/url"
+import "net/http"
+import "net/http/httptest"
+
+// test the hosts & paths allowed by every scope
+func TestScope(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	seed, _ := url.Parse("https://www.example.co.uk/docs/")
+	tests := []struct {
+		opts    Options
+		url     string
+		allowed bool
+	}{
+		{Options{}, "https://www.example.co.uk/a", true},
+		{Options{}, "https://blog.example.co.uk/a", false},
+		{Options{Scope: ScopeDomain}, "http://blog.example.co.uk/a", true},
+		{Options{Scope: ScopeDomain}, "https://example.co.uk/a", true},
+		{Options{Scope: ScopeDomain}, "https://other.co.uk/a", false},
+		{Options{Scope: ScopeHosts, Hosts: []string{"CDN.example.com"}}, "https://cdn.example.com/a", true},
+		{Options{Scope: ScopeHosts, Hosts: []string{"cdn.example.com"}}, "https://www.example.co.uk/a", true},
+		{Options{Scope: ScopeHosts, Hosts: []string{"cdn.example.com"}}, "https://blog.example.co.uk/a", false},
+		{Options{Scope: ScopePrefix}, "https://www.example.co.uk/docs/a/b", true},
+		{Options{Scope: ScopePrefix}, "https://www.example.co.uk/docs", true},
+		{Options{Scope: ScopePrefix}, "https://www.example.co.uk/docsearch", false},
+		{Options{Scope: ScopePrefix}, "https://www.example.co.uk/about", false},
+	}
+
+	for _, test := range tests {
+		u, _ := url.Parse(test.url)
+		if allowed := newScope(seed, test.opts).allows(u); allowed != test.allowed {
+			t.Fatalf("expected %v for %v in %+v, got: %v\n", test.allowed, test.url, test.opts, allowed)
+		}
+	}
+
+	if err := (Options{Scope: "world"}).validate(); err != ErrUnsupportedScope {
+		t.Fatalf("expected ErrUnsupportedScope, got: %v\n", err)
+	}
+}
+
+// test the hosts of the allowlist are crawled, as per their own robots.txt
+func TestCrawlHostsScope(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	var mu sync.Mutex
+	fetched := make(map[string]int)
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetched[r.URL.Path]++
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<title>Other</title>`))
+		}
+	}))
+	defer other.Close()
+
+	server := newTestSite(map[string]string{
+		"/": `<title>Home</title>` +
+			`<a href="` + other.URL + `/a">A</a>` +
+			`<a href="` + other.URL + `/b">B</a>` +
+			`<a href="` + other.URL + `/private">Private</a>`,
+	})
+	defer server.Close()
+
+	c := New()
+	defer c.Close()
+
+	otherURL, _ := url.Parse(other.URL)
+	opts := Options{Scope: ScopeHosts, Hosts: []string{otherURL.Host}}
+	if err := c.CrawlWithOptions(server.URL+"/", opts); err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	worker := c.Worker(server.URL + "/")
+	<-worker.Done()
+
+	if len(worker.Tree.Nodes) != 2 || fetched["/robots.txt"] != 1 || fetched["/private"] != 0 {
+		t.Fatalf("expected the 2 allowed pages, robots.txt once, got: %v, %v\n", worker.Tree.Nodes, fetched)
+	}
+}
@@ -0,0 +1,163 @@
+package crawler
+
+// module deps
+import "sort"
+import "sync"
+import "strings"
+import "unicode"
+import "hash/fnv"
+import "math/bits"
+
+// constants
+const (
+	// words per shingle of a SimHash
+	simHashShingle = 3
+
+	// max Hamming distance between the SimHashes of near-duplicates
+	DefaultSimHashDistance = 3
+)
+
+// SimHash returns the 64-bit SimHash of the text, over its lower
+// cased 3-word shingles; texts that differ slightly have hashes
+// that differ in a few bits. the SimHash of a text without words
+// is 0
+// @see https://www.cs.princeton.edu/courses/archive/spr04/cos598B/bib/CharikarEstim.pdf
+func SimHash(text string) uint64 {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	if len(words) == 0 {
+		return 0
+	}
+
+	n := simHashShingle
+	if len(words) < n {
+		n = len(words)
+	}
+
+	var weights [64]int
+	for i := 0; i+n <= len(words); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:i+n], " ")))
+		sum := h.Sum64()
+		for bit := uint(0); bit < 64; bit++ {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	var hash uint64
+	for bit := uint(0); bit < 64; bit++ {
+		if weights[bit] > 0 {
+			hash |= 1 << bit
+		}
+	}
+
+	return hash
+}
+
+// hammingDistance returns the number of bits that differ
+func hammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// simIndex finds the near-duplicates of a SimHash without comparing
+// it to every other; the hashes are split into distance + 1 blocks,
+// and by the pigeonhole principle two hashes within the distance
+// have at least one block in common. it is safe for concurrent use
+type simIndex struct {
+	// mutex
+	mu sync.Mutex
+
+	// max Hamming distance
+	distance int
+
+	// indexed hashes, and their URLs
+	hashes []uint64
+	urls   []string
+
+	// indexes of the hashes by block number & value
+	blocks map[[2]uint64][]int
+}
+
+// newSimIndex returns an empty index for the distance
+func newSimIndex(distance int) *simIndex {
+	return &simIndex{distance: distance, blocks: make(map[[2]uint64][]int)}
+}
+
+// keys returns the block keys of a hash
+func (x *simIndex) keys(hash uint64) [][2]uint64 {
+	n := uint(x.distance + 1)
+	keys := make([][2]uint64, 0, n)
+	for i := uint(0); i < n; i++ {
+		from, to := i*64/n, (i+1)*64/n
+		block := hash >> from & (1<<(to-from) - 1)
+		keys = append(keys, [2]uint64{uint64(i), block})
+	}
+
+	return keys
+}
+
+// matches returns the indexes of the hashes within the distance,
+// in the order they were indexed
+func (x *simIndex) matches(hash uint64) []int {
+	seen := make(map[int]struct{})
+	for _, key := range x.keys(hash) {
+		for _, i := range x.blocks[key] {
+			if hammingDistance(hash, x.hashes[i]) <= x.distance {
+				seen[i] = struct{}{}
+			}
+		}
+	}
+
+	matches := make([]int, 0, len(seen))
+	for i := range seen {
+		matches = append(matches, i)
+	}
+
+	sort.Ints(matches)
+	return matches
+}
+
+// insert indexes the hash of the URL, and returns its index
+func (x *simIndex) insert(uri string, hash uint64) int {
+	i := len(x.hashes)
+	x.hashes = append(x.hashes, hash)
+	x.urls = append(x.urls, uri)
+	for _, key := range x.keys(hash) {
+		x.blocks[key] = append(x.blocks[key], i)
+	}
+
+	return i
+}
+
+// add indexes the hash of the URL, unless the hash of another URL
+// is within the distance, in which case that URL is returned
+func (x *simIndex) add(uri string, hash uint64) string {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if matches := x.matches(hash); len(matches) > 0 {
+		return x.urls[matches[0]]
+	}
+
+	x.insert(uri, hash)
+	return ""
+}
+
+// nearDuplicate reports if the visible text of a page is within
+// DefaultSimHashDistance of a page crawled already, when the crawl
+// skips the children of near-duplicates; the page is recorded as
+// the duplicate of that page
+func (w *Worker) nearDuplicate(resource *Resource) bool {
+	if w.fingerprints == nil || resource.SimHash == 0 {
+		return false
+	}
+
+	resource.DuplicateOf = w.fingerprints.add(resource.URLString, resource.SimHash)
+	return resource.DuplicateOf != ""
+}
@@ -0,0 +1,54 @@
+package crawler
+
+// module deps
+import "testing"
+
+// test SimHash of similar texts differ in a few bits
+func TestSimHash(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	a := SimHash("The quick brown fox jumps over the lazy dog, again and again, until the dog finally wakes up and chases the fox away.")
+	b := SimHash("the quick brown fox jumps over the lazy dog again and again until the dog finally wakes up and chases the fox away")
+	c := SimHash("The quick brown fox jumps over the lazy dog, again and again, until the cat finally wakes up and chases the fox away.")
+	d := SimHash("Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua.")
+
+	if a == 0 || a != b {
+		t.Fatalf("expected the same SimHash regardless of case & punctuation, got: %x, %x\n", a, b)
+	}
+
+	if distance := hammingDistance(a, c); distance > 16 {
+		t.Fatalf("expected a small distance, got: %d\n", distance)
+	}
+
+	if distance := hammingDistance(a, d); distance <= 16 {
+		t.Fatalf("expected a large distance, got: %d\n", distance)
+	}
+
+	if SimHash(" , ") != 0 {
+		t.Fatalf("expected 0 without words\n")
+	}
+}
+
+// test simIndex finds the hashes within the distance
+func TestSimIndex(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	x := newSimIndex(3)
+	if original := x.add("/a", 0xff00ff00ff00ff00); original != "" {
+		t.Fatalf("expected no match, got: %v\n", original)
+	}
+
+	if original := x.add("/b", 0xff00ff00ff00ff07); original != "/a" {
+		t.Fatalf("expected /a within 3 bits, got: %v\n", original)
+	}
+
+	if original := x.add("/c", 0xff00ff00ff00ff0f); original != "" {
+		t.Fatalf("expected no match beyond 3 bits, got: %v\n", original)
+	}
+
+	if matches := newSimIndex(0).matches(1); len(matches) != 0 {
+		t.Fatalf("expected no match in an empty index, got: %v\n", matches)
+	}
+}
@@ -0,0 +1,157 @@
+package crawler
+
+// module deps
+import "io"
+import "fmt"
+import "log"
+import "time"
+import "bufio"
+import "strings"
+import "net/url"
+import "net/http"
+import "compress/gzip"
+import "encoding/xml"
+
+// constants
+const (
+	// max uncompressed size of a sitemap, per the sitemaps protocol
+	// @see https://www.sitemaps.org/protocol.html
+	MaxSitemapSize = 50 * 1024 * 1024
+
+	// max sitemaps fetched per worker, including index children
+	MaxSitemapsPerWorker = 1000
+)
+
+// relative path of sitemap.xml at the domain level, used
+// when robots.txt does not declare a Sitemap directive
+var sitemapParsedPath, _ = url.Parse("/sitemap.xml")
+
+// sitemapLoc is a <url> or <sitemap> entry
+type sitemapLoc struct {
+	Loc string `xml:"loc"`
+}
+
+// sitemap is either a <urlset> or a <sitemapindex>
+type sitemap struct {
+	XMLName  xml.Name
+	URLs     []sitemapLoc `xml:"url"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+// parseSitemap decodes a sitemap or a sitemap index; gzip
+// compressed sitemaps are detected by their magic number
+// since servers do not reliably set the Content-Encoding
+func parseSitemap(r io.Reader) (*sitemap, error) {
+	buf := bufio.NewReader(r)
+	if magic, err := buf.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buf)
+		if err != nil {
+			return nil, err
+		}
+
+		defer gz.Close()
+		r = gz
+	} else {
+		r = buf
+	}
+
+	sm := new(sitemap)
+	decoder := xml.NewDecoder(io.LimitReader(r, MaxSitemapSize))
+	decoder.Strict = false
+	if err := decoder.Decode(sm); err != nil {
+		return nil, err
+	}
+
+	return sm, nil
+}
+
+// fetchSitemap fetches & parses the sitemap at the given location
+func (c *Crawler) fetchSitemap(worker *Worker, loc string) (*sitemap, error) {
+	req, err := http.NewRequest(http.MethodGet, loc, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.WithContext(worker.ctx)
+	req.Header.Add("User-Agent", c.UserAgent)
+	if err := worker.limiter.wait(worker.ctx); err != nil {
+		return nil, err
+	}
+
+	resp, err := worker.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+
+	return parseSitemap(resp.Body)
+}
+
+// seedSitemaps walks the sitemaps, descending into sitemap
+// indexes, and enqueues every <loc> that belongs to the
+// domain as a depth-1 resource under the worker's seed
+func (c *Crawler) seedSitemaps(worker *Worker, sitemaps []string) {
+	defer worker.wg.Done()
+	defer worker.pop(nil)
+
+	if len(sitemaps) == 0 {
+		sitemaps = []string{worker.seed.ResolveReference(sitemapParsedPath).String()}
+	}
+
+	seen := make(map[string]struct{})
+	for len(sitemaps) > 0 && len(seen) < MaxSitemapsPerWorker {
+		loc := sitemaps[0]
+		sitemaps = sitemaps[1:]
+
+		if _, ok := seen[loc]; ok {
+			continue
+		}
+
+		seen[loc] = struct{}{}
+		sm, err := c.fetchSitemap(worker, loc)
+		if err != nil {
+			log.Printf("[ERROR] failed to fetch sitemap: %v, error: %v\n", loc, err)
+			continue
+		}
+
+		// the <loc> of pretty-printed sitemaps is padded with whitespace
+		for _, child := range sm.Sitemaps {
+			sitemaps = append(sitemaps, strings.TrimSpace(child.Loc))
+		}
+
+		for _, entry := range sm.URLs {
+			absolute := normaliseURL(strings.TrimSpace(entry.Loc), worker.seed)
+			if absolute == nil {
+				continue
+			}
+
+			canonical := c.Canonicalizer.Canonical(absolute)
+			if !worker.scope.allows(canonical) {
+				continue
+			}
+
+			if c.q.isClosed() || worker.ctx.Err() != nil {
+				return
+			}
+
+			resource := &Resource{
+				URL:         canonical,
+				URLString:   canonical.String(),
+				RawURL:      absolute.String(),
+				Root:        worker.seed,
+				Nodes:       make([]*Resource, 0),
+				Parent:      []string{worker.Tree.URLString},
+				Depth:       1,
+				LastFetched: time.Now(),
+				worker:      worker,
+			}
+
+			worker.push(resource)
+			c.schedule(resource)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package crawler
+
+// module deps
+import "bytes"
+import "strings"
+import "testing"
+import "compress/gzip"
+
+// test parseSitemap with a urlset
+func TestParseSitemapURLSet(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	doc := strings.NewReader(`<?xml version="1.0" encoding="UTF-8"?>
+		<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+			<url><loc>http://example.com/a</loc></url>
+			<url><loc>http://example.com/b</loc><lastmod>2018-01-01</lastmod></url>
+		</urlset>`)
+	sm, err := parseSitemap(doc)
+
+	if err != nil || len(sm.URLs) != 2 || sm.URLs[1].Loc != "http://example.com/b" {
+		t.Fatalf("expected 2 urls, got: %v, err: %v\n", sm, err)
+	}
+}
+
+// test parseSitemap with a gzip compressed sitemap index
+func TestParseSitemapIndexGzip(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	buf := new(bytes.Buffer)
+	gz := gzip.NewWriter(buf)
+	gz.Write([]byte(`<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+		<sitemap><loc>http://example.com/sitemap1.xml.gz</loc></sitemap>
+	</sitemapindex>`))
+	gz.Close()
+	sm, err := parseSitemap(buf)
+
+	if err != nil || len(sm.Sitemaps) != 1 || sm.Sitemaps[0].Loc != "http://example.com/sitemap1.xml.gz" {
+		t.Fatalf("expected 1 sitemap, got: %v, err: %v\n", sm, err)
+	}
+}
+
+// test a crawl with sitemaps enqueues the <loc> entries in scope
+// under the seed, falling back to /sitemap.xml & descending into
+// sitemap indexes, whether they are pretty-printed or not
+func TestCrawlSitemaps(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	pages := map[string]string{
+		"/":  `<title>Home</title>`,
+		"/a": `<title>A</title>`,
+		"/b": `<title>B</title>`,
+	}
+
+	server := newTestSite(pages)
+	defer server.Close()
+
+	pages["/sitemap.xml"] = `<sitemapindex><sitemap><loc>
+		` + server.URL + `/pages.xml
+	</loc></sitemap></sitemapindex>`
+	pages["/pages.xml"] = `<urlset>
+		<url><loc>
+			` + server.URL + `/a
+		</loc></url>
+		<url><loc>/b</loc></url>
+		<url><loc>http://other.invalid/c</loc></url>
+	</urlset>`
+
+	c := New()
+	defer c.Close()
+
+	if err := c.CrawlWithOptions(server.URL+"/", Options{Depth: 2, UseSitemaps: true}); err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	worker := c.Worker(server.URL + "/")
+	<-worker.Done()
+
+	titles := make(map[string]string)
+	for _, node := range worker.Tree.Nodes {
+		titles[node.URLString] = node.Title
+		if node.Depth != 1 || len(node.Parent) != 1 || node.Parent[0] != worker.Tree.URLString {
+			t.Fatalf("expected a depth-1 resource under the seed, got: %v\n", node)
+		}
+	}
+
+	if len(titles) != 2 || titles[server.URL+"/a"] != "A" || titles[server.URL+"/b"] != "B" {
+		t.Fatalf("expected /a & /b from the sitemap, got: %v\n", titles)
+	}
+}
@@ -0,0 +1,59 @@
+package crawler
+
+// module deps
+import "time"
+
+// Snapshot is the tree of one crawl run of a domain; runs
+// are numbered from 1, the current run being the highest
+type Snapshot struct {
+	// run number
+	ID int `json:"id"`
+
+	// run start timestamp
+	Started time.Time `json:"started"`
+
+	// run status
+	Status WorkerStatus `json:"status"`
+
+	// nodes tree
+	Tree *Resource `json:"tree,omitempty"`
+}
+
+// snapshot returns the worker's current run as a snapshot
+func (w *Worker) snapshot() *Snapshot {
+	return &Snapshot{
+		ID:      w.run,
+		Started: w.started,
+		Status:  w.Status(),
+		Tree:    w.Tree,
+	}
+}
+
+// Run returns the number of the worker's current run
+func (w *Worker) Run() int {
+	return w.run
+}
+
+// Snapshots returns the retained previous runs, oldest first
+func (w *Worker) Snapshots() []*Snapshot {
+	snapshots := make([]*Snapshot, len(w.snapshots))
+	copy(snapshots, w.snapshots)
+	return snapshots
+}
+
+// Snapshot returns the run with the given number, which is
+// either a retained previous run or the current run; nil
+// is returned when no such run exists
+func (w *Worker) Snapshot(id int) *Snapshot {
+	if id == w.run {
+		return w.snapshot()
+	}
+
+	for _, snapshot := range w.snapshots {
+		if snapshot.ID == id {
+			return snapshot
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,320 @@
+package crawler
+
+// module deps
+import "sync"
+import "time"
+import "net/url"
+
+// WorkerRecord is the persisted metadata of a worker
+type WorkerRecord struct {
+	// seed URL, which is also the registry key
+	Domain string `json:"domain"`
+
+	// crawl settings
+	Options Options `json:"options"`
+
+	// fetch status
+	Status WorkerStatus `json:"status"`
+
+	// run number & start timestamp
+	Run     int       `json:"run"`
+	Started time.Time `json:"started"`
+}
+
+// ResourceRecord is the persisted form of a Resource, which
+// unlike the tree's JSON form includes the parent ancestry
+type ResourceRecord struct {
+	URL            string       `json:"url"`
+	RawURL         string       `json:"raw_url,omitempty"`
+	Canonical      string       `json:"canonical,omitempty"`
+	Title          string       `json:"title"`
+	HTTPStatusCode int          `json:"status"`
+	Kind           ResourceKind `json:"kind,omitempty"`
+	ContentType    string       `json:"content_type,omitempty"`
+	ContentLength  int64        `json:"content_length,omitempty"`
+	Error          string       `json:"error,omitempty"`
+	Attempts       int          `json:"attempts,omitempty"`
+	Redirects      []Redirect   `json:"redirects,omitempty"`
+	FinalURL       string       `json:"final_url,omitempty"`
+	SimHash        uint64       `json:"simhash,string,omitempty"`
+	DuplicateOf    string       `json:"duplicate_of,omitempty"`
+	NoIndex        bool         `json:"noindex,omitempty"`
+	NoFollow       bool         `json:"nofollow,omitempty"`
+	Parent         []string     `json:"parent"`
+	Depth          int          `json:"depth"`
+	LastFetched    time.Time    `json:"last_fetched"`
+	Links          []Edge       `json:"links,omitempty"`
+}
+
+// Store persists the state of the crawler's workers; the
+// visited set, the frontier & the resources are kept for
+// the current run of a worker, the previous runs are kept
+// as snapshots. implementations must be safe for concurrent
+// use by multiple goroutines
+type Store interface {
+	// SaveWorker creates or updates the metadata of a worker
+	SaveWorker(record *WorkerRecord) error
+
+	// LoadWorkers returns the metadata of every worker
+	LoadWorkers() ([]*WorkerRecord, error)
+
+	// DeleteWorker removes a worker and all of its state
+	DeleteWorker(domain string) error
+
+	// Visit marks a URL as visited, and reports if it was already
+	Visit(domain, uri string) (bool, error)
+
+	// Visited returns the visited set of the current run
+	Visited(domain string) ([]string, error)
+
+	// SaveFrontier replaces the frontier of the current run
+	SaveFrontier(domain string, frontier []*ResourceRecord) error
+
+	// LoadFrontier returns the frontier of the current run
+	LoadFrontier(domain string) ([]*ResourceRecord, error)
+
+	// SaveResource appends a fetched resource to the current run
+	SaveResource(domain string, resource *ResourceRecord) error
+
+	// LoadResources returns the fetched resources of the current
+	// run, in the order that they were saved
+	LoadResources(domain string) ([]*ResourceRecord, error)
+
+	// SaveSnapshot retains a previous run, discarding the
+	// oldest ones beyond keep; keep <= 0 retains every run
+	SaveSnapshot(domain string, snapshot *Snapshot, keep int) error
+
+	// LoadSnapshots returns the retained runs, oldest first
+	LoadSnapshots(domain string) ([]*Snapshot, error)
+
+	// ClearRun removes the visited set, the frontier & the
+	// resources of the current run, ahead of the next one
+	ClearRun(domain string) error
+
+	// Close releases the resources held by the store
+	Close() error
+}
+
+// queued returns the persisted form of a resource on the
+// frontier, which is all that is known before it is fetched
+func (r *Resource) queued() *ResourceRecord {
+	return &ResourceRecord{
+		URL:    r.URLString,
+		RawURL: r.RawURL,
+		Parent: r.Parent,
+		Depth:  r.Depth,
+	}
+}
+
+// record returns the persisted form of the resource
+func (r *Resource) record() *ResourceRecord {
+	return &ResourceRecord{
+		URL:            r.URLString,
+		RawURL:         r.RawURL,
+		Canonical:      r.Canonical,
+		Title:          r.Title,
+		HTTPStatusCode: r.HTTPStatusCode,
+		Kind:           r.Kind,
+		ContentType:    r.ContentType,
+		ContentLength:  r.ContentLength,
+		Error:          r.Error,
+		Attempts:       r.Attempts,
+		Redirects:      r.Redirects,
+		FinalURL:       r.FinalURL,
+		SimHash:        r.SimHash,
+		DuplicateOf:    r.DuplicateOf,
+		NoIndex:        r.NoIndex,
+		NoFollow:       r.NoFollow,
+		Parent:         r.Parent,
+		Depth:          r.Depth,
+		LastFetched:    r.LastFetched,
+		Links:          r.links,
+	}
+}
+
+// resource returns the resource of the record, owned by the worker
+func (rr *ResourceRecord) resource(worker *Worker) (*Resource, error) {
+	u, err := url.Parse(rr.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Resource{
+		URL:            u,
+		URLString:      rr.URL,
+		RawURL:         rr.RawURL,
+		Canonical:      rr.Canonical,
+		Title:          rr.Title,
+		HTTPStatusCode: rr.HTTPStatusCode,
+		Kind:           rr.Kind,
+		ContentType:    rr.ContentType,
+		ContentLength:  rr.ContentLength,
+		Error:          rr.Error,
+		Attempts:       rr.Attempts,
+		Redirects:      rr.Redirects,
+		FinalURL:       rr.FinalURL,
+		SimHash:        rr.SimHash,
+		DuplicateOf:    rr.DuplicateOf,
+		NoIndex:        rr.NoIndex,
+		NoFollow:       rr.NoFollow,
+		Root:           worker.seed,
+		Parent:         rr.Parent,
+		Depth:          rr.Depth,
+		Nodes:          make([]*Resource, 0),
+		LastFetched:    rr.LastFetched,
+		links:          rr.Links,
+		worker:         worker,
+	}, nil
+}
+
+// memoryState is the state of a worker in the MemoryStore
+type memoryState struct {
+	record   *WorkerRecord
+	visited  map[string]struct{}
+	frontier []*ResourceRecord
+}
+
+// MemoryStore is a Store that keeps the state in memory
+// and therefore does not survive a restart of the crawler;
+// the resources & snapshots are held by the worker alone,
+// so they are not saved, and are never loaded
+type MemoryStore struct {
+	// mutex
+	mu sync.Mutex
+
+	// state by domain
+	states map[string]*memoryState
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{states: make(map[string]*memoryState)}
+}
+
+// state returns the state of a domain, creating it on first use;
+// the caller holds the mutex
+func (s *MemoryStore) state(domain string) *memoryState {
+	state, exists := s.states[domain]
+	if !exists {
+		state = &memoryState{visited: make(map[string]struct{})}
+		s.states[domain] = state
+	}
+
+	return state
+}
+
+// SaveWorker creates or updates the metadata of a worker
+func (s *MemoryStore) SaveWorker(record *WorkerRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := *record
+	s.state(record.Domain).record = &saved
+	return nil
+}
+
+// LoadWorkers returns the metadata of every worker
+func (s *MemoryStore) LoadWorkers() ([]*WorkerRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := make([]*WorkerRecord, 0, len(s.states))
+	for _, state := range s.states {
+		if state.record != nil {
+			saved := *state.record
+			records = append(records, &saved)
+		}
+	}
+
+	return records, nil
+}
+
+// DeleteWorker removes a worker and all of its state
+func (s *MemoryStore) DeleteWorker(domain string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.states, domain)
+	return nil
+}
+
+// Visit marks a URL as visited, and reports if it was already
+func (s *MemoryStore) Visit(domain, uri string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.state(domain)
+	_, visited := state.visited[uri]
+	if !visited {
+		state.visited[uri] = struct{}{}
+	}
+
+	return visited, nil
+}
+
+// Visited returns the visited set of the current run
+func (s *MemoryStore) Visited(domain string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.state(domain)
+	visited := make([]string, 0, len(state.visited))
+	for uri := range state.visited {
+		visited = append(visited, uri)
+	}
+
+	return visited, nil
+}
+
+// SaveFrontier replaces the frontier of the current run
+func (s *MemoryStore) SaveFrontier(domain string, frontier []*ResourceRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state(domain).frontier = append([]*ResourceRecord(nil), frontier...)
+	return nil
+}
+
+// LoadFrontier returns the frontier of the current run
+func (s *MemoryStore) LoadFrontier(domain string) ([]*ResourceRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*ResourceRecord(nil), s.state(domain).frontier...), nil
+}
+
+// SaveResource is a no-op, the resource is held by the worker's tree
+func (s *MemoryStore) SaveResource(domain string, resource *ResourceRecord) error {
+	return nil
+}
+
+// LoadResources returns no resources, since none are saved
+func (s *MemoryStore) LoadResources(domain string) ([]*ResourceRecord, error) {
+	return nil, nil
+}
+
+// SaveSnapshot is a no-op, the run is held by the worker's snapshots
+func (s *MemoryStore) SaveSnapshot(domain string, snapshot *Snapshot, keep int) error {
+	return nil
+}
+
+// LoadSnapshots returns no snapshots, since none are saved
+func (s *MemoryStore) LoadSnapshots(domain string) ([]*Snapshot, error) {
+	return nil, nil
+}
+
+// ClearRun removes the state of the current run
+func (s *MemoryStore) ClearRun(domain string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.state(domain)
+	state.visited = make(map[string]struct{})
+	state.frontier = nil
+	return nil
+}
+
+// Close releases the resources held by the store
+func (s *MemoryStore) Close() error {
+	return nil
+}
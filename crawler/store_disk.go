@@ -0,0 +1,405 @@
+package crawler
+
+// module deps
+import "os"
+import "sort"
+import "sync"
+import "bufio"
+import "strconv"
+import "net/url"
+import "io/ioutil"
+import "path/filepath"
+import "encoding/json"
+
+// files of a worker in the DiskStore
+const (
+	workerFile    = "worker.json"
+	visitedFile   = "visited.log"
+	resourcesFile = "resources.log"
+	frontierFile  = "frontier.json"
+	snapshotsDir  = "snapshots"
+)
+
+// DiskStore is a Store that keeps the state on disk, under a
+// directory per worker; the metadata & frontier are replaced
+// atomically, while the visited set and the resources are
+// append-only logs, so that a crash loses at most a record
+type DiskStore struct {
+	// mutex
+	mu sync.Mutex
+
+	// data directory
+	dir string
+
+	// visited sets, loaded from the logs on first use
+	visited map[string]map[string]struct{}
+
+	// append-only logs open for writing
+	logs map[string]*os.File
+}
+
+// NewDiskStore returns a DiskStore rooted at the directory,
+// which is created if it does not exist
+func NewDiskStore(dir string) (*DiskStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &DiskStore{
+		dir:     dir,
+		visited: make(map[string]map[string]struct{}),
+		logs:    make(map[string]*os.File),
+	}, nil
+}
+
+// path returns the path of a file of a worker
+func (s *DiskStore) path(domain string, elem ...string) string {
+	return filepath.Join(append([]string{s.dir, url.QueryEscape(domain)}, elem...)...)
+}
+
+// writeJSON atomically replaces the file with the JSON encoding of v
+func writeJSON(path string, v interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+	if err = json.NewEncoder(tmp).Encode(v); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// readJSON decodes the file into v; a missing file is not an error
+func readJSON(path string, v interface{}) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+	return json.NewDecoder(f).Decode(v)
+}
+
+// readLines calls fn with every line of the log, a missing
+// log is not an error; a torn last line is skipped by fn
+func readLines(path string, fn func(line []byte)) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		fn(scanner.Bytes())
+	}
+
+	return scanner.Err()
+}
+
+// appendLine appends a line to the log; the caller holds the mutex
+func (s *DiskStore) appendLine(path string, line []byte) error {
+	f, open := s.logs[path]
+	if !open {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+
+		var err error
+		f, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+
+		s.logs[path] = f
+	}
+
+	_, err := f.Write(append(line, '\n'))
+	return err
+}
+
+// closeLogs closes the open logs of a worker; the caller holds the mutex
+func (s *DiskStore) closeLogs(domain string) {
+	for _, name := range []string{visitedFile, resourcesFile} {
+		path := s.path(domain, name)
+		if f, open := s.logs[path]; open {
+			f.Close()
+			delete(s.logs, path)
+		}
+	}
+}
+
+// SaveWorker creates or updates the metadata of a worker
+func (s *DiskStore) SaveWorker(record *WorkerRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return writeJSON(s.path(record.Domain, workerFile), record)
+}
+
+// LoadWorkers returns the metadata of every worker
+func (s *DiskStore) LoadWorkers() ([]*WorkerRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dirs, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]*WorkerRecord, 0, len(dirs))
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+
+		var record *WorkerRecord
+		if err = readJSON(filepath.Join(s.dir, dir.Name(), workerFile), &record); err != nil {
+			return nil, err
+		}
+
+		if record != nil {
+			records = append(records, record)
+		}
+	}
+
+	return records, nil
+}
+
+// DeleteWorker removes a worker and all of its state
+func (s *DiskStore) DeleteWorker(domain string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closeLogs(domain)
+	delete(s.visited, domain)
+	return os.RemoveAll(s.path(domain))
+}
+
+// visitedSet returns the visited set of a worker, loading it
+// from the log on first use; the caller holds the mutex
+func (s *DiskStore) visitedSet(domain string) (map[string]struct{}, error) {
+	if visited, loaded := s.visited[domain]; loaded {
+		return visited, nil
+	}
+
+	visited := make(map[string]struct{})
+	err := readLines(s.path(domain, visitedFile), func(line []byte) {
+		visited[string(line)] = struct{}{}
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.visited[domain] = visited
+	return visited, nil
+}
+
+// Visit marks a URL as visited, and reports if it was already
+func (s *DiskStore) Visit(domain, uri string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	visited, err := s.visitedSet(domain)
+	if err != nil {
+		return false, err
+	}
+
+	if _, ok := visited[uri]; ok {
+		return true, nil
+	}
+
+	visited[uri] = struct{}{}
+	return false, s.appendLine(s.path(domain, visitedFile), []byte(uri))
+}
+
+// Visited returns the visited set of the current run
+func (s *DiskStore) Visited(domain string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	visited, err := s.visitedSet(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	uris := make([]string, 0, len(visited))
+	for uri := range visited {
+		uris = append(uris, uri)
+	}
+
+	return uris, nil
+}
+
+// SaveFrontier replaces the frontier of the current run
+func (s *DiskStore) SaveFrontier(domain string, frontier []*ResourceRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return writeJSON(s.path(domain, frontierFile), frontier)
+}
+
+// LoadFrontier returns the frontier of the current run
+func (s *DiskStore) LoadFrontier(domain string) ([]*ResourceRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var frontier []*ResourceRecord
+	return frontier, readJSON(s.path(domain, frontierFile), &frontier)
+}
+
+// SaveResource appends a fetched resource to the current run
+func (s *DiskStore) SaveResource(domain string, resource *ResourceRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	line, err := json.Marshal(resource)
+	if err != nil {
+		return err
+	}
+
+	return s.appendLine(s.path(domain, resourcesFile), line)
+}
+
+// LoadResources returns the fetched resources of the current run
+func (s *DiskStore) LoadResources(domain string) ([]*ResourceRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	resources := make([]*ResourceRecord, 0)
+	err := readLines(s.path(domain, resourcesFile), func(line []byte) {
+		resource := new(ResourceRecord)
+		if json.Unmarshal(line, resource) == nil {
+			resources = append(resources, resource)
+		}
+	})
+
+	return resources, err
+}
+
+// snapshotIDs returns the ids of the retained runs, in order;
+// the caller holds the mutex
+func (s *DiskStore) snapshotIDs(domain string) ([]int, error) {
+	files, err := ioutil.ReadDir(s.path(domain, snapshotsDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(files))
+	for _, f := range files {
+		ext := filepath.Ext(f.Name())
+		if id, err := strconv.Atoi(f.Name()[:len(f.Name())-len(ext)]); err == nil && ext == ".json" {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// SaveSnapshot retains a previous run
+func (s *DiskStore) SaveSnapshot(domain string, snapshot *Snapshot, keep int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the tree is only ever mutated under the root's lock
+	if snapshot.Tree != nil {
+		snapshot.Tree.Lock()
+		defer snapshot.Tree.Unlock()
+	}
+
+	err := writeJSON(s.path(domain, snapshotsDir, strconv.Itoa(snapshot.ID)+".json"), snapshot)
+	if err != nil || keep <= 0 {
+		return err
+	}
+
+	ids, err := s.snapshotIDs(domain)
+	for len(ids) > keep && err == nil {
+		err = os.Remove(s.path(domain, snapshotsDir, strconv.Itoa(ids[0])+".json"))
+		ids = ids[1:]
+	}
+
+	return err
+}
+
+// LoadSnapshots returns the retained runs, oldest first
+func (s *DiskStore) LoadSnapshots(domain string) ([]*Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids, err := s.snapshotIDs(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]*Snapshot, 0, len(ids))
+	for _, id := range ids {
+		snapshot := new(Snapshot)
+		if err = readJSON(s.path(domain, snapshotsDir, strconv.Itoa(id)+".json"), snapshot); err != nil {
+			return nil, err
+		}
+
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return snapshots, nil
+}
+
+// ClearRun removes the state of the current run
+func (s *DiskStore) ClearRun(domain string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closeLogs(domain)
+	delete(s.visited, domain)
+	for _, name := range []string{visitedFile, resourcesFile, frontierFile} {
+		if err := os.Remove(s.path(domain, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close closes the open logs
+func (s *DiskStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	for path, f := range s.logs {
+		if cerr := f.Close(); cerr != nil {
+			err = cerr
+		}
+
+		delete(s.logs, path)
+	}
+
+	return err
+}
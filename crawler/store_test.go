@@ -0,0 +1,230 @@
+package crawler
+
+// module deps
+import "os"
+import "time"
+import "testing"
+import "io/ioutil"
+
+// test the Store implementations behave alike
+func TestStores(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "gocrawler")
+	if err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	defer os.RemoveAll(dir)
+	disk, err := NewDiskStore(dir)
+	if err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	for name, store := range map[string]Store{"memory": NewMemoryStore(), "disk": disk} {
+		domain := "http://example.com"
+		if err := store.SaveWorker(&WorkerRecord{Domain: domain, Status: StatusFetchingInProgress, Run: 1}); err != nil {
+			t.Fatalf("%s: expected nil error, got: %v\n", name, err)
+		}
+
+		records, err := store.LoadWorkers()
+		if err != nil || len(records) != 1 || records[0].Status != StatusFetchingInProgress {
+			t.Fatalf("%s: expected 1 in-progress worker, got: %v, err: %v\n", name, records, err)
+		}
+
+		if visited, _ := store.Visit(domain, "http://example.com/a"); visited {
+			t.Fatalf("%s: expected first visit\n", name)
+		}
+
+		if visited, _ := store.Visit(domain, "http://example.com/a"); !visited {
+			t.Fatalf("%s: expected second visit\n", name)
+		}
+
+		// the memory store leaves the resources & snapshots to the worker
+		saved := 1
+		if name == "memory" {
+			saved = 0
+		}
+
+		store.SaveResource(domain, &ResourceRecord{URL: "http://example.com/a", Title: "A"})
+		if resources, err := store.LoadResources(domain); err != nil || len(resources) != saved || (saved > 0 && resources[0].Title != "A") {
+			t.Fatalf("%s: expected %d resources, got: %v, err: %v\n", name, saved, resources, err)
+		}
+
+		store.SaveFrontier(domain, []*ResourceRecord{{URL: "http://example.com/b"}})
+		if frontier, err := store.LoadFrontier(domain); err != nil || len(frontier) != 1 {
+			t.Fatalf("%s: expected 1 queued resource, got: %v, err: %v\n", name, frontier, err)
+		}
+
+		for id := 1; id <= 3; id++ {
+			store.SaveSnapshot(domain, &Snapshot{ID: id, Started: time.Now()}, 2)
+		}
+
+		if snapshots, err := store.LoadSnapshots(domain); err != nil || len(snapshots) != 2*saved || (saved > 0 && snapshots[0].ID != 2) {
+			t.Fatalf("%s: expected snapshots 2 & 3, got: %v, err: %v\n", name, snapshots, err)
+		}
+
+		if err := store.ClearRun(domain); err != nil {
+			t.Fatalf("%s: expected nil error, got: %v\n", name, err)
+		}
+
+		if visited, _ := store.Visited(domain); len(visited) != 0 {
+			t.Fatalf("%s: expected empty visited set, got: %v\n", name, visited)
+		}
+
+		if err := store.DeleteWorker(domain); err != nil {
+			t.Fatalf("%s: expected nil error, got: %v\n", name, err)
+		}
+
+		if records, _ := store.LoadWorkers(); len(records) != 0 {
+			t.Fatalf("%s: expected no workers, got: %v\n", name, records)
+		}
+
+		store.Close()
+	}
+}
+
+// test a finished crawl is restored from the disk
+func TestLoad(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	server := newTestSite(map[string]string{
+		"/":  `<title>Home</title><a href="/a">A</a>`,
+		"/a": `<title>A</title>`,
+	})
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "gocrawler")
+	if err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	defer os.RemoveAll(dir)
+	domain := server.URL + "/"
+
+	c := New()
+	c.Store, _ = NewDiskStore(dir)
+	if err := c.Crawl(domain, 2); err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	<-c.Worker(domain).Done()
+	c.Close()
+
+	restored := New()
+	defer restored.Close()
+	restored.Store, _ = NewDiskStore(dir)
+	if err := restored.Load(); err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	worker := restored.Worker(domain)
+	if worker == nil || worker.Status() != StatusFetchingComplete {
+		t.Fatalf("expected a complete worker, got: %v\n", worker)
+	}
+
+	if worker.Tree.Title != "Home" || len(worker.Tree.Nodes) != 1 || worker.Tree.Nodes[0].Title != "A" {
+		t.Fatalf("expected Home > A, got: %v\n", worker.Tree)
+	}
+	if edges := worker.Graph.Edges(); len(edges) != 1 || edges[0].Target != domain+"a" {
+		t.Fatalf("expected an edge to A, got: %v\n", edges)
+	}
+}
+
+// test Load resumes an interrupted crawl from its frontier
+func TestLoadResume(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	server := newTestSite(map[string]string{
+		"/":  `<title>Home</title><a href="/a">A</a>`,
+		"/a": `<title>A</title><a href="/b">B</a>`,
+		"/b": `<title>B</title>`,
+	})
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "gocrawler")
+	if err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	// the state of a crawl interrupted once the seed was fetched
+	domain := server.URL + "/"
+	store, _ := NewDiskStore(dir)
+	store.SaveWorker(&WorkerRecord{Domain: domain, Options: Options{Depth: 3}, Status: StatusFetchingInProgress, Run: 1})
+	store.Visit(domain, domain)
+	store.Visit(domain, server.URL+"/a")
+	store.SaveResource(domain, &ResourceRecord{URL: domain, Title: "Home", HTTPStatusCode: 200, Depth: 1})
+	store.SaveFrontier(domain, []*ResourceRecord{
+		{URL: domain, Depth: 1},
+		{URL: server.URL + "/a", Parent: []string{domain}, Depth: 2},
+		{URL: server.URL + "/a", Parent: []string{domain}, Depth: 2},
+	})
+
+	c := New()
+	defer c.Close()
+	c.Store = store
+	if err := c.Load(); err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	worker := c.Worker(domain)
+	if worker == nil || !worker.Resumed() {
+		t.Fatalf("expected a resumed worker, got: %v\n", worker)
+	}
+
+	<-worker.Done()
+	if worker.Status() != StatusFetchingComplete {
+		t.Fatalf("expected status complete, got: %v\n", worker.Status())
+	}
+
+	if len(worker.Tree.Nodes) != 1 || worker.Tree.Nodes[0].Title != "A" || len(worker.Tree.Nodes[0].Nodes) != 1 {
+		t.Fatalf("expected Home > A > B, got: %v\n", worker.Tree.Nodes)
+	}
+}
+
+// test the frontier is checkpointed while its resources are fetched
+func TestCheckpointDuringFetch(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	server := newTestSite(map[string]string{
+		"/":  `<title>Home</title><a href="/a">A</a><a href="/b">B</a>`,
+		"/a": `<title>A</title>`,
+		"/b": `<title>B</title>`,
+	})
+	defer server.Close()
+
+	c := New()
+	defer c.Close()
+
+	domain := server.URL + "/"
+	if err := c.Crawl(domain, 2); err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	worker := c.Worker(domain)
+	for done := false; !done; {
+		select {
+		case <-worker.Done():
+			done = true
+		default:
+			worker.checkpoint()
+		}
+	}
+
+	frontier, err := c.Store.LoadFrontier(domain)
+	if err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	for _, rr := range frontier {
+		if rr.URL == "" || rr.Title != "" || rr.Kind != "" {
+			t.Fatalf("expected the queued resources only, got: %v\n", rr)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package crawler
+
+// module deps
+import "io"
+import "os"
+import "fmt"
+import "log"
+import "sync"
+import "time"
+import "bytes"
+import "errors"
+import "net/url"
+import "net/http"
+import "io/ioutil"
+import "crypto/rand"
+import "crypto/sha1"
+import "path/filepath"
+import "compress/gzip"
+import "encoding/base32"
+
+// ErrArchiveNotConfigured is used when a crawl is to be
+// archived, but the crawler has no archive directory
+var ErrArchiveNotConfigured = errors.New("archive directory is not configured")
+
+// warcWriter writes the responses of a crawl run to a WARC 1.1
+// file, each record compressed as a separate gzip member so that
+// the file can be appended to & read from any record offset
+// @see https://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/
+type warcWriter struct {
+	// mutex
+	mu sync.Mutex
+
+	// open archive file
+	f *os.File
+}
+
+// archiveDir returns the directory of the WARC files of the domain
+func (c *Crawler) archiveDir(domain string) string {
+	return filepath.Join(c.ArchiveDir, url.QueryEscape(domain))
+}
+
+// ArchivePath returns the path of the WARC file of a run of the domain
+func (c *Crawler) ArchivePath(domain string, run int) string {
+	return filepath.Join(c.archiveDir(domain), fmt.Sprintf("%d.warc.gz", run))
+}
+
+// retireArchive moves the WARC files of a deleted domain aside, to
+// a directory named after the time of the deletion, so that a later
+// crawl of the domain does not append to the files of its runs
+func (c *Crawler) retireArchive(domain string) error {
+	if c.ArchiveDir == "" {
+		return nil
+	}
+
+	dir := c.archiveDir(domain)
+	files, err := filepath.Glob(filepath.Join(dir, "*.warc.gz"))
+	if err != nil || len(files) == 0 {
+		return err
+	}
+
+	deleted := filepath.Join(dir, "deleted", time.Now().UTC().Format("20060102T150405.000000000Z"))
+	if err = os.MkdirAll(deleted, 0755); err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err = os.Rename(file, filepath.Join(deleted, filepath.Base(file))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// openArchive opens the WARC file of a run of the domain for
+// appending, and records the crawler in a warcinfo record
+func (c *Crawler) openArchive(domain string, run int) (*warcWriter, error) {
+	if c.ArchiveDir == "" {
+		return nil, ErrArchiveNotConfigured
+	}
+
+	path := c.ArchivePath(domain, run)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &warcWriter{f: f}
+	info := fmt.Sprintf("software: %s\r\nformat: WARC File Format 1.1\r\nisPartOf: %s\r\n", c.UserAgent, domain)
+	if err = a.write(warcID(), "warcinfo", "", "application/warc-fields", "", nil, []byte(info), false); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// close closes the archive file; a nil writer is a no-op
+func (a *warcWriter) close() {
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.f != nil {
+		a.f.Close()
+		a.f = nil
+	}
+}
+
+// warcID returns a new record id, a random (version 4) UUID
+func warcID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// warcDigest returns the SHA-1 digest of the data, as is usual in WARC
+func warcDigest(data []byte) string {
+	sum := sha1.Sum(data)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+// write appends a record; the payload, when not nil, is the part of
+// the block which is digested as the payload, and a truncated block
+// is marked as cut short by length. a record written after the
+// archive is closed is dropped
+func (a *warcWriter) write(id, kind, target, contentType, concurrentTo string, payload, block []byte, truncated bool) error {
+	var header bytes.Buffer
+	fmt.Fprintf(&header, "WARC/1.1\r\n")
+	fmt.Fprintf(&header, "WARC-Type: %s\r\n", kind)
+	fmt.Fprintf(&header, "WARC-Record-ID: %s\r\n", id)
+	fmt.Fprintf(&header, "WARC-Date: %s\r\n", time.Now().UTC().Format("2006-01-02T15:04:05.000000Z"))
+	if target != "" {
+		fmt.Fprintf(&header, "WARC-Target-URI: %s\r\n", target)
+	}
+
+	if concurrentTo != "" {
+		fmt.Fprintf(&header, "WARC-Concurrent-To: %s\r\n", concurrentTo)
+	}
+
+	fmt.Fprintf(&header, "Content-Type: %s\r\n", contentType)
+	fmt.Fprintf(&header, "WARC-Block-Digest: %s\r\n", warcDigest(block))
+	if payload != nil {
+		fmt.Fprintf(&header, "WARC-Payload-Digest: %s\r\n", warcDigest(payload))
+	}
+
+	if truncated {
+		fmt.Fprintf(&header, "WARC-Truncated: length\r\n")
+	}
+
+	fmt.Fprintf(&header, "Content-Length: %d\r\n\r\n", len(block))
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.f == nil {
+		return nil
+	}
+
+	gz := gzip.NewWriter(a.f)
+	gz.Write(header.Bytes())
+	gz.Write(block)
+	gz.Write([]byte("\r\n\r\n"))
+	return gz.Close()
+}
+
+// archive writes a response record, and the request record
+// concurrent to it
+func (a *warcWriter) archive(resp *http.Response, body []byte, truncated bool) error {
+	req := resp.Request
+	target := req.URL.String()
+
+	// the response is reconstructed from the parsed headers, the
+	// body is as decoded by the client, e.g. after de-chunking
+	var block bytes.Buffer
+	fmt.Fprintf(&block, "HTTP/%d.%d %s\r\n", resp.ProtoMajor, resp.ProtoMinor, resp.Status)
+	resp.Header.Write(&block)
+	block.WriteString("\r\n")
+	block.Write(body)
+
+	id := warcID()
+	if err := a.write(id, "response", target, "application/http;msgtype=response", "", body, block.Bytes(), truncated); err != nil {
+		return err
+	}
+
+	var request bytes.Buffer
+	fmt.Fprintf(&request, "%s %s HTTP/1.1\r\n", req.Method, req.URL.RequestURI())
+	fmt.Fprintf(&request, "Host: %s\r\n", req.URL.Host)
+	req.Header.Write(&request)
+	request.WriteString("\r\n")
+	return a.write(warcID(), "request", target, "application/http;msgtype=request", id, nil, request.Bytes(), false)
+}
+
+// archivedBody tees the body of a response, which is archived
+// once the body is closed; the part of the body which was not
+// read is read first, so that the archive is complete, up to
+// the crawler's max body size
+type archivedBody struct {
+	io.ReadCloser
+	a    *warcWriter
+	resp *http.Response
+	buf  bytes.Buffer
+}
+
+// Read definition for archivedBody
+func (b *archivedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	return n, err
+}
+
+// Close definition for archivedBody
+func (b *archivedBody) Close() error {
+	io.Copy(ioutil.Discard, b)
+	truncated := false
+	if limited, ok := b.ReadCloser.(*limitedBody); ok {
+		truncated = limited.truncated
+	}
+
+	if err := b.a.archive(b.resp, b.buf.Bytes(), truncated); err != nil {
+		log.Printf("[ERROR] failed to archive response: %v, error: %v\n", b.resp.Request.URL.String(), err)
+	}
+
+	return b.ReadCloser.Close()
+}
+
+// wrap arranges for the response to be archived once its body
+// is closed; a nil writer is a no-op
+func (a *warcWriter) wrap(resp *http.Response) {
+	if a == nil || resp.Body == nil {
+		return
+	}
+
+	resp.Body = &archivedBody{ReadCloser: resp.Body, a: a, resp: resp}
+}
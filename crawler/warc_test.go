@@ -0,0 +1,99 @@
+package crawler
+
+// module deps
+import "os"
+import "strings"
+import "testing"
+import "io/ioutil"
+import "path/filepath"
+import "compress/gzip"
+
+// test an archived crawl writes every response to the WARC file
+func TestArchive(t *testing.T) {
+	// execute test in parallel
+	t.Parallel()
+
+	server := newTestSite(map[string]string{
+		"/":  `<title>Home</title><a href="/a">A</a>`,
+		"/a": `<title>A</title>`,
+	})
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "gocrawler")
+	if err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	defer os.RemoveAll(dir)
+	domain := server.URL + "/"
+
+	c := New()
+	defer c.Close()
+	if err := c.CrawlWithOptions(domain, Options{Archive: true}); err != ErrArchiveNotConfigured {
+		t.Fatalf("expected ErrArchiveNotConfigured, got: %v\n", err)
+	}
+
+	c.ArchiveDir = dir
+	if err := c.CrawlWithOptions(domain, Options{Depth: 2, Archive: true}); err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	<-c.Worker(domain).Done()
+
+	f, err := os.Open(c.ArchivePath(domain, 1))
+	if err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	data, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	// robots.txt, then a GET per page
+	archive := string(data)
+	if n := strings.Count(archive, "WARC-Type: response\r\n"); n != 3 {
+		t.Fatalf("expected 3 responses, got: %d\n", n)
+	}
+
+	if n := strings.Count(archive, "WARC-Type: request\r\n"); n != 3 {
+		t.Fatalf("expected 3 requests, got: %d\n", n)
+	}
+
+	if !strings.HasPrefix(archive, "WARC/1.1\r\nWARC-Type: warcinfo\r\n") || !strings.Contains(archive, "\r\n\r\n<title>Home</title>") {
+		t.Fatalf("expected a warcinfo record & the pages, got: %v\n", archive)
+	}
+
+	// the archive of a deleted crawl is moved aside, and a
+	// new crawl of the domain starts a new file for its run
+	if err := c.Cancel(domain); err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	kept, err := filepath.Glob(filepath.Join(c.archiveDir(domain), "deleted", "*", "1.warc.gz"))
+	if err != nil || len(kept) != 1 {
+		t.Fatalf("expected the archive to be kept, got: %v, %v\n", kept, err)
+	}
+
+	if err := c.CrawlWithOptions(domain, Options{Depth: 1, Archive: true}); err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	<-c.Worker(domain).Done()
+
+	prev, err := os.Stat(kept[0])
+	if err != nil {
+		t.Fatalf("expected nil error, got: %v\n", err)
+	}
+
+	next, err := os.Stat(c.ArchivePath(domain, 1))
+	if err != nil || next.Size() >= prev.Size() {
+		t.Fatalf("expected a new archive for the run, got: %v, %v\n", next, err)
+	}
+}
@@ -2,9 +2,12 @@ package crawler
 
 // moduel deps
 import "fmt"
+import "log"
 import "sync"
 import "time"
+import "context"
 import "net/url"
+import "net/http"
 import "encoding/json"
 import "github.com/temoto/robotstxt-go"
 
@@ -17,6 +20,7 @@ const (
 	StatusFetchingInProgress
 	StatusFetchingComplete
 	StatusFetchingError
+	StatusCancelled
 )
 
 // fmt.Stringer definition
@@ -30,11 +34,30 @@ func (s WorkerStatus) String() string {
 		return "complete"
 	case StatusFetchingError:
 		return "error"
+	case StatusCancelled:
+		return "cancelled"
 	default:
 		return ""
 	}
 }
 
+// UnmarshalJSON definition for WorkerStatus
+func (s *WorkerStatus) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+
+	for status := StatusInitialised; status <= StatusCancelled; status++ {
+		if status.String() == name {
+			*s = status
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Invalid Status: %s", name)
+}
+
 // MarshalJSON definition for WorkerStatus
 func (s WorkerStatus) MarshalJSON() ([]byte, error) {
 	if r, ok := interface{}(s).(fmt.Stringer); ok {
@@ -46,55 +69,313 @@ func (s WorkerStatus) MarshalJSON() ([]byte, error) {
 
 // Worker is a crawler specific to a domain
 type Worker struct {
-	// inherit wg
-	sync.WaitGroup
+	// goroutines in flight
+	wg sync.WaitGroup
 
 	// mutex
 	mu sync.Mutex
 
+	// cancelled when the crawl is cancelled
+	ctx    context.Context
+	cancel context.CancelFunc
+
 	// seed URL
 	seed *url.URL
 
+	// crawl settings
+	opts Options
+
 	// crawl depth
 	crawlDepth int
 
 	// robots agent group
 	agent *robotstxt.Group
 
-	// visited URLs
-	tracker map[string]struct{}
+	// http client, with the crawl's connect timeout
+	client *http.Client
+
+	// per-domain rate limiter, shared by the hosts in scope
+	limiter *limiter
+
+	// include & exclude patterns of the crawl
+	filter *urlFilter
+
+	// hosts & paths of the crawl
+	scope *scope
+
+	// robots.txt of the hosts other than the seed's
+	robots map[string]*hostRobots
+
+	// SimHashes of the pages crawled, when the children
+	// of near-duplicates are skipped
+	fingerprints *simIndex
+
+	// persists the worker's state
+	store Store
 
 	// fetch status
 	status WorkerStatus
 
+	// resources queued or being fetched, along with the
+	// record of each taken as it was pushed, and the tasks
+	// that may still add to them
+	pending  int
+	frontier map[*Resource]*ResourceRecord
+
+	// resumed after a restart of the crawler
+	resumed bool
+
+	// closed once the frontier is empty
+	done     chan struct{}
+	finished bool
+
+	// fetched resources of the current run, in order,
+	// and the subscribers to the ones fetched next
+	fetched     []*Resource
+	subscribers map[chan *Event]struct{}
+
+	// WARC file of the run, when archived
+	archive *warcWriter
+
 	// nodes tree
 	Tree *Resource
 
+	// link graph, retained alongside the tree
+	Graph *Graph
+
 	// last updated timestamp
 	LastUpdated time.Time
+
+	// run number & start timestamp
+	run     int
+	started time.Time
+
+	// previous runs, oldest first
+	snapshots []*Snapshot
 }
 
 // visited tracks if a URL has been crawled before
-// to achieve this, we use a sync.Mutex to make it
+// the visited set is kept by the store, which is
 // safe for concurrent use by multiple goroutines
 func (w *Worker) visited(uri string) bool {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-
-	_, crawled := w.tracker[uri]
-	if !crawled {
-		w.tracker[uri] = struct{}{}
+	crawled, err := w.store.Visit(w.seed.String(), uri)
+	if err != nil {
+		log.Printf("[ERROR] failed to save visited URL: %v, error: %v\n", uri, err)
 	}
 
 	return crawled
 }
 
+// attach adds a node to the list at the correct
+// leaf in the tree belonging to the root node
+func (w *Worker) attach(resource *Resource) {
+	if w.Tree == resource {
+		return
+	}
+
+	w.Tree.Lock()
+	defer w.Tree.Unlock()
+	w.LastUpdated = time.Now()
+
+	// insert children at depth > 1
+	if len(resource.Parent) == 1 && resource.Parent[0] == w.Tree.URL.String() {
+		w.Tree.Nodes = append(w.Tree.Nodes, resource)
+		return
+	}
+
+	addNode(w.Tree, resource)
+}
+
+// record returns the persisted metadata of the worker
+func (w *Worker) record() *WorkerRecord {
+	return &WorkerRecord{
+		Domain:  w.seed.String(),
+		Options: w.opts,
+		Status:  w.Status(),
+		Run:     w.run,
+		Started: w.started,
+	}
+}
+
+// save persists the worker's metadata
+func (w *Worker) save() {
+	if err := w.store.SaveWorker(w.record()); err != nil {
+		log.Printf("[ERROR] failed to save worker: %v, error: %v\n", w.seed.String(), err)
+	}
+}
+
 // Status describes the worker's status
 func (w *Worker) Status() WorkerStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
 	return w.status
 }
 
+// setStatus updates the worker's status
+func (w *Worker) setStatus(status WorkerStatus) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.status = status
+}
+
+// begin marks the crawl in progress, once it starts fetching,
+// unless it was stopped meanwhile; it reports if it was marked
+func (w *Worker) begin() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.status != StatusInitialised || w.ctx.Err() != nil {
+		return false
+	}
+
+	w.status = StatusFetchingInProgress
+	return true
+}
+
+// acquire registers a task in flight with the worker's
+// WaitGroup, unless the crawl has been cancelled; it is
+// done under the mutex so that stop cannot race the Add
+func (w *Worker) acquire() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.ctx.Err() != nil {
+		return false
+	}
+
+	w.wg.Add(1)
+	return true
+}
+
+// stop cancels the requests in flight and waits for the
+// worker's goroutines to drain; the status of a running
+// crawl is set first, so that it is final by the time the
+// done channel is closed
+func (w *Worker) stop(status WorkerStatus) {
+	w.mu.Lock()
+	if w.status == StatusInitialised || w.status == StatusFetchingInProgress {
+		w.status = status
+	}
+
+	w.cancel()
+	w.mu.Unlock()
+
+	w.wg.Wait()
+
+	w.mu.Lock()
+	w.finish()
+	w.mu.Unlock()
+}
+
+// push adds a resource to the worker's frontier; it must be
+// called before the resource it was discovered from is popped
+// so that the frontier cannot be seen empty in the meanwhile.
+// a nil resource stands for a task that adds to the frontier
+func (w *Worker) push(resource *Resource) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.pending++
+	if resource != nil {
+		w.frontier[resource] = resource.queued()
+	}
+}
+
+// pop takes a resource off the worker's frontier, once it is
+// fetched or dropped; the crawl completes when none is left.
+// once the worker is stopped, the resource is kept for the
+// checkpoint, since it is no longer going to be fetched, and
+// the done channel is left to stop to close
+func (w *Worker) pop(resource *Resource) {
+	w.mu.Lock()
+	w.pending--
+	if resource != nil && w.ctx.Err() == nil {
+		delete(w.frontier, resource)
+	}
+
+	completed := w.pending == 0 && w.ctx.Err() == nil
+	if completed {
+		w.status = StatusFetchingComplete
+	}
+
+	if completed {
+		w.finish()
+	}
+
+	w.mu.Unlock()
+
+	// a stopped worker is not persisted, since
+	// it may have been removed from the store
+	if completed {
+		w.save()
+	}
+}
+
+// finish closes the done channel & the archive, exactly
+// once; the caller holds the mutex
+func (w *Worker) finish() {
+	if !w.finished {
+		w.finished = true
+		w.archive.close()
+		close(w.done)
+	}
+}
+
+// Done returns a channel that is closed when the crawl is
+// over, either because the frontier is empty or because
+// the crawl was stopped
+func (w *Worker) Done() <-chan struct{} {
+	return w.done
+}
+
+// checkpoint persists the frontier of an unfinished crawl,
+// so that it can be resumed after a restart of the crawler
+func (w *Worker) checkpoint() {
+	if w.Status() == StatusFetchingComplete {
+		return
+	}
+
+	// the records taken by push, since the resources
+	// being fetched are written to meanwhile
+	w.mu.Lock()
+	frontier := make([]*ResourceRecord, 0, len(w.frontier))
+	for _, record := range w.frontier {
+		frontier = append(frontier, record)
+	}
+
+	w.mu.Unlock()
+
+	if err := w.store.SaveFrontier(w.seed.String(), frontier); err != nil {
+		log.Printf("[ERROR] failed to save frontier: %v, error: %v\n", w.seed.String(), err)
+	}
+}
+
+// Resumed reports if the crawl was resumed after a restart
+func (w *Worker) Resumed() bool {
+	return w.resumed
+}
+
+// Pending returns the number of resources queued or being fetched
+func (w *Worker) Pending() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.pending
+}
+
 // CrawlDepth returns the worker's depth
 func (w *Worker) CrawlDepth() int {
 	return w.crawlDepth
 }
+
+// CrawlDelay returns the interval between two requests to the domain
+func (w *Worker) CrawlDelay() time.Duration {
+	return w.limiter.delay()
+}
+
+// Politeness returns the current pace of the requests to the domain
+func (w *Worker) Politeness() Politeness {
+	return w.limiter.state()
+}
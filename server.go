@@ -19,6 +19,8 @@ const version = "0.1.1"
 const usage = `gocrawler v%s
 Usage:
   gocrawler -p 8080 -a 127.0.0.1
+  gocrawler -p 8080 -a 127.0.0.1 -data /var/lib/gocrawler
+  gocrawler -p 8080 -a 127.0.0.1 -archive /var/lib/gocrawler/warc
   gocrawler -h | -help
   gocrawler -v | -version
 `
@@ -26,6 +28,8 @@ Usage:
 // flag variables
 var bindAddress = flag.String("a", "127.0.0.1", "server bind address")
 var bindPort = flag.String("p", "8080", "server bind port to listen")
+var dataDir = flag.String("data", "", "directory to persist crawls in; in memory when empty")
+var archiveDir = flag.String("archive", "", "directory to write the WARC files of archived crawls in")
 var fHelp = flag.Bool("h", false, "show help")
 var fVers = flag.Bool("v", false, "show version")
 
@@ -62,6 +66,25 @@ func main() {
 		Crawler: crawler.New(),
 	}
 
+	// archived crawls are refused without a directory
+	handler.Crawler.ArchiveDir = *archiveDir
+
+	// persist crawls on disk, and restore the
+	// ones persisted by a previous instance
+	if *dataDir != "" {
+		store, err := crawler.NewDiskStore(*dataDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cannot open data directory: %v\n", err)
+			os.Exit(1)
+		}
+
+		handler.Crawler.Store = store
+		if err = handler.Crawler.Load(); err != nil {
+			fmt.Fprintf(os.Stderr, "cannot restore crawls: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// swagger template
 	t := &Template{
 		templates: template.Must(
@@ -83,7 +106,7 @@ func main() {
 	// CORS middleware
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins: []string{"*"},
-		AllowMethods: []string{echo.GET, echo.POST},
+		AllowMethods: []string{echo.GET, echo.POST, echo.DELETE},
 	}))
 
 	// register api handlers
@@ -91,7 +114,19 @@ func main() {
 	e.GET("/swagger.yaml", renderSwagger)
 	e.POST("/api/domains", handler.CreateDomainHandler)
 	e.GET("/api/domains/:domain", handler.GetDomainHandler)
+	e.DELETE("/api/domains/:domain", handler.DeleteDomainHandler)
 	e.GET("/api/domains/:domain/status", handler.GetDomainStatusHandler)
+	e.GET("/api/domains/:domain/events", handler.GetDomainEventsHandler)
+	e.POST("/api/domains/:domain/recrawl", handler.RecrawlDomainHandler)
+	e.GET("/api/domains/:domain/snapshots", handler.GetDomainSnapshotsHandler)
+	e.GET("/api/domains/:domain/snapshots/:id", handler.GetDomainSnapshotHandler)
+	e.GET("/api/domains/:domain/diff", handler.GetDomainDiffHandler)
+	e.GET("/api/domains/:domain/graph", handler.GetDomainGraphHandler)
+	e.GET("/api/domains/:domain/export", handler.GetDomainExportHandler)
+	e.GET("/api/domains/:domain/archive", handler.GetDomainArchiveHandler)
+	e.GET("/api/domains/:domain/report/broken-links", handler.GetDomainBrokenLinksHandler)
+	e.GET("/api/domains/:domain/report/duplicates", handler.GetDomainDuplicatesHandler)
+	e.GET("/api/domains/:domain/report/redirects", handler.GetDomainRedirectsHandler)
 
 	// start api server
 	go func() {
@@ -101,7 +136,7 @@ func main() {
 	}()
 
 	// wait for interrupt signal to shutdown the server with a timeout
-	interrupt := make(chan os.Signal)
+	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM)
 
 	<-interrupt